@@ -0,0 +1,483 @@
+package nknwallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+// Every account has a type saying how its seed is protected, e.g. SCRYPT or
+// IDENTITY. An AccountType implements one way of protecting accounts and is
+// registered under a name. Accounts are decrypted and rekeyed by the type
+// registered under their lower case Type; new accounts are created by the type
+// the caller names. Library users can register their own types with
+// RegisterAccountType.
+
+// AccountKey is what an account is encrypted to or decrypted with. Each
+// account type uses the fields it needs.
+type AccountKey struct {
+	// Identity is an age identity file, e.g. an age, SSH or plugin key.
+	Identity string
+	// RecipientFile is a file listing age recipients, one per line.
+	RecipientFile string
+	// Recipient is a single age recipient, e.g. "age1...", an SSH public key
+	// or "github:<user>".
+	Recipient string
+	// Passphrase is the passphrase of the account. If it is empty and one is
+	// needed it is asked from the PassphraseProvider of the store.
+	Passphrase string
+}
+
+// AccountType encrypts, decrypts and rekeys the accounts of one kind.
+type AccountType interface {
+	// Name is the name the type is registered under, in lower case.
+	Name() string
+	// Encrypt returns a new account protecting account with key. ID,
+	// address and configuration are set by the store.
+	Encrypt(s *Store, account *nkn.Account, key AccountKey) (*Wallet, error)
+	// Decrypt returns the account of w decrypted with key.
+	Decrypt(s *Store, w *Wallet, key AccountKey) (*nkn.Account, error)
+	// Rekey protects the decrypted account w with key instead and saves it.
+	Rekey(s *Store, w *Wallet, key AccountKey) error
+	// Describe returns a short description of how w is protected.
+	Describe(w *Wallet) string
+}
+
+var (
+	accountTypesMu sync.RWMutex
+	accountTypes   = map[string]AccountType{}
+)
+
+func init() {
+	RegisterAccountType(scryptAccountType{})
+	RegisterAccountType(recipientsAccountType{name: "identity", recipients: identityRecipients})
+	RegisterAccountType(recipientsAccountType{name: "recipient-file", recipients: recipientFileRecipients})
+	RegisterAccountType(recipientsAccountType{name: "recipient", recipients: recipientRecipients})
+	RegisterAccountType(twoFactorAccountType{})
+	RegisterAccountType(watchAccountType{})
+	RegisterAccountType(externalAccountType{})
+}
+
+// RegisterAccountType makes t available under its name. It panics if the name
+// is empty or taken already.
+func RegisterAccountType(t AccountType) {
+	name := strings.ToLower(t.Name())
+	if len(name) == 0 {
+		panic("nknwallet: account type has no name")
+	}
+	accountTypesMu.Lock()
+	defer accountTypesMu.Unlock()
+	if _, ok := accountTypes[name]; ok {
+		panic("nknwallet: account type " + name + " registered twice")
+	}
+	accountTypes[name] = t
+}
+
+// LookupAccountType returns the account type registered under name.
+func LookupAccountType(name string) (AccountType, error) {
+	accountTypesMu.RLock()
+	defer accountTypesMu.RUnlock()
+	t, ok := accountTypes[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown account type %s.", name)
+	}
+	return t, nil
+}
+
+// AccountTypes returns the names of the registered account types, sorted.
+func AccountTypes() []string {
+	accountTypesMu.RLock()
+	defer accountTypesMu.RUnlock()
+	var names []string
+	for name := range accountTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// accountTypeOf returns the account type w is stored as.
+func accountTypeOf(w *Wallet) (AccountType, error) {
+	if len(w.Type) == 0 {
+		return nil, errors.New("Wallet is missing type information.")
+	}
+	return LookupAccountType(w.Type)
+}
+
+// Describe returns a short description of how the account is protected.
+func (w *Wallet) Describe() string {
+	t, err := accountTypeOf(w)
+	if err != nil {
+		return w.Type
+	}
+	return t.Describe(w)
+}
+
+// NewWallet returns the account with index decrypted with key by the type it
+// is stored as. If index is 0 a new account protected with key by the account
+// type typ is created instead.
+func (s *Store) NewWallet(typ string, key AccountKey, index int, config *nkn.WalletConfig) (*Wallet, error) {
+	if index > 0 {
+		return s.DecryptWallet(index, key, config)
+	}
+	account, err := nkn.NewAccount(nil)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.RestoreFromSeed(typ, account.Seed(), key)
+	if err != nil {
+		return nil, err
+	}
+	if w.config, err = nkn.MergeWalletConfig(config); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// RestoreFromSeed returns a new account for seed protected with key by the
+// account type typ. It is not saved; use SaveWallet.
+func (s *Store) RestoreFromSeed(typ string, seed []byte, key AccountKey) (*Wallet, error) {
+	t, err := LookupAccountType(typ)
+	if err != nil {
+		return nil, err
+	}
+	return s.restoreFromSeed(seed, func(account *nkn.Account) (*Wallet, error) {
+		return t.Encrypt(s, account, key)
+	})
+}
+
+// restoreFromSeed returns a new account for seed, protected by encrypt.
+func (s *Store) restoreFromSeed(seed []byte, encrypt func(account *nkn.Account) (*Wallet, error)) (*Wallet, error) {
+	account, err := nkn.NewAccount(seed)
+	if err != nil {
+		return nil, err
+	}
+	w, err := encrypt(account)
+	if err != nil {
+		return nil, err
+	}
+	if w.config, err = nkn.MergeWalletConfig(nil); err != nil {
+		return nil, err
+	}
+	w.ID = s.getNextID()
+	w.NKNAddress = account.WalletAddress()
+	w.account = account
+	return w, nil
+}
+
+// DecryptWallet returns the account with index decrypted with key by the type
+// it is stored as.
+func (s *Store) DecryptWallet(index int, key AccountKey, config *nkn.WalletConfig) (*Wallet, error) {
+	w, err := s.GetWalletByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	t, err := accountTypeOf(w)
+	if err != nil {
+		return nil, err
+	}
+	account, err := t.Decrypt(s, w, key)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, errors.New("Something went wrong.")
+	}
+	if account.WalletAddress() != w.Address() {
+		return nil, errors.New("Decrypted account does not match the address.")
+	}
+	if w.config, err = nkn.MergeWalletConfig(config); err != nil {
+		return nil, err
+	}
+	w.account = account
+	return w, nil
+}
+
+// RekeyWallet protects the decrypted account with key by the type it is
+// stored as, e.g. with a new passphrase.
+func (s *Store) RekeyWallet(wallet *Wallet, key AccountKey) error {
+	if wallet.Account() == nil {
+		return errors.New("Wallet is not decrypted.")
+	}
+	t, err := accountTypeOf(wallet)
+	if err != nil {
+		return err
+	}
+	return t.Rekey(s, wallet, key)
+}
+
+// newKeyPassphrase returns the passphrase of key, or a new one asked from the
+// PassphraseProvider.
+func (s *Store) newKeyPassphrase(key AccountKey) (string, error) {
+	if len(key.Passphrase) > 0 {
+		return key.Passphrase, nil
+	}
+	return newPassphrase(s.PassphraseProvider())
+}
+
+// changedKeyPassphrase is like newKeyPassphrase, but for a passphrase
+// replacing the current one of an account.
+func (s *Store) changedKeyPassphrase(key AccountKey) (string, error) {
+	if len(key.Passphrase) > 0 {
+		return key.Passphrase, nil
+	}
+	return changedPassphrase(s.PassphraseProvider())
+}
+
+// keyPassphraseProvider returns a PassphraseProvider answering with the
+// passphrase of key, or the one of the store if key has none.
+func (s *Store) keyPassphraseProvider(key AccountKey) PassphraseProvider {
+	if len(key.Passphrase) > 0 {
+		return staticPassphrase(key.Passphrase)
+	}
+	return s.PassphraseProvider()
+}
+
+// scryptAccountType protects SCRYPT accounts with a passphrase.
+type scryptAccountType struct{}
+
+func (scryptAccountType) Name() string { return "scrypt" }
+
+func (scryptAccountType) Encrypt(s *Store, account *nkn.Account, key AccountKey) (*Wallet, error) {
+	pass, err := s.newKeyPassphrase(key)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.ScryptRecipient(pass)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := s.encryptAccount(account, []age.Recipient{r})
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{
+		Type:          "SCRYPT",
+		Armor:         enc.armor,
+		RecoveryArmor: enc.recoveryArmor,
+		Recovery:      enc.recovery,
+		KDF:           enc.kdf,
+	}, nil
+}
+
+func (scryptAccountType) Decrypt(s *Store, w *Wallet, key AccountKey) (*nkn.Account, error) {
+	if len(key.Identity) > 0 || len(key.RecipientFile) > 0 || len(key.Recipient) > 0 {
+		return nil, errors.New("Wallet is an scrypt type. Use a password to decrypt it.")
+	}
+	return decryptAccountByPassword(w, s.keyPassphraseProvider(key))
+}
+
+func (scryptAccountType) Rekey(s *Store, w *Wallet, key AccountKey) error {
+	// ask for the new passphrase before taking the lock on the wallet file
+	pass, err := s.changedKeyPassphrase(key)
+	if err != nil {
+		return err
+	}
+	r, err := s.ScryptRecipient(pass)
+	if err != nil {
+		return err
+	}
+	return s.Rekey(w, []age.Recipient{r})
+}
+
+func (scryptAccountType) Describe(w *Wallet) string {
+	if n := w.ScryptWorkFactor(); n > 0 {
+		return fmt.Sprintf("passphrase (scrypt %d)", n)
+	}
+	return "passphrase"
+}
+
+// recipientsAccountType protects IDENTITY accounts by encrypting them to age
+// recipients, taken from key by recipients. They are decrypted with an
+// identity file.
+type recipientsAccountType struct {
+	name       string
+	recipients func(s *Store, key AccountKey) ([]age.Recipient, error)
+}
+
+func identityRecipients(s *Store, key AccountKey) ([]age.Recipient, error) {
+	if len(key.Identity) == 0 {
+		return nil, errors.New("Need an identity file.")
+	}
+	return s.ParseIdentity(key.Identity)
+}
+
+func recipientFileRecipients(s *Store, key AccountKey) ([]age.Recipient, error) {
+	if len(key.RecipientFile) == 0 {
+		return nil, errors.New("Need a recipients file.")
+	}
+	return s.ParseRecipientFile(key.RecipientFile)
+}
+
+func recipientRecipients(s *Store, key AccountKey) ([]age.Recipient, error) {
+	if len(key.Recipient) == 0 {
+		return nil, errors.New("Need a recipient.")
+	}
+	return s.ParseRecipient(key.Recipient)
+}
+
+func (t recipientsAccountType) Name() string { return t.name }
+
+func (t recipientsAccountType) Encrypt(s *Store, account *nkn.Account, key AccountKey) (*Wallet, error) {
+	recipients, err := t.recipients(s, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.encryptToRecipients(account, recipients)
+}
+
+// encryptToRecipients returns a new IDENTITY account encrypting account to
+// recipients.
+func (s *Store) encryptToRecipients(account *nkn.Account, recipients []age.Recipient) (*Wallet, error) {
+	enc, err := s.encryptAccount(account, recipients)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{
+		Type:          "IDENTITY",
+		Armor:         enc.armor,
+		RecoveryArmor: enc.recoveryArmor,
+		Recovery:      enc.recovery,
+		Recipients:    recordedRecipients(recipients),
+		KDF:           enc.kdf,
+	}, nil
+}
+
+func (recipientsAccountType) Decrypt(s *Store, w *Wallet, key AccountKey) (*nkn.Account, error) {
+	if len(key.Identity) == 0 {
+		return nil, errors.New("Account is encrypted to age recipients. Use an identity file to decrypt it.")
+	}
+	return decryptAccountByIdentityFile(w, key.Identity, s.PassphraseProvider())
+}
+
+// Rekey encrypts w to the recipients of every source set in key. Accounts of
+// all recipients types are saved as IDENTITY, so the type w was created by is
+// not known here.
+func (recipientsAccountType) Rekey(s *Store, w *Wallet, key AccountKey) error {
+	var recipients []age.Recipient
+	for _, source := range []struct {
+		set        bool
+		recipients func(s *Store, key AccountKey) ([]age.Recipient, error)
+	}{
+		{len(key.Identity) > 0, identityRecipients},
+		{len(key.RecipientFile) > 0, recipientFileRecipients},
+		{len(key.Recipient) > 0, recipientRecipients},
+	} {
+		if !source.set {
+			continue
+		}
+		r, err := source.recipients(s, key)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, r...)
+	}
+	if len(recipients) == 0 {
+		return errors.New("Account is encrypted to age recipients. Use an identity file, a recipients file or a recipient to rekey it.")
+	}
+	return s.Rekey(w, recipients)
+}
+
+func (recipientsAccountType) Describe(w *Wallet) string {
+	switch {
+	case len(w.NamedRecipients) > 0:
+		return "recipients " + strings.Join(w.NamedRecipients, ", ")
+	case len(w.Recipients) == 1:
+		return "1 recipient"
+	case len(w.Recipients) > 1:
+		return fmt.Sprintf("%d recipients", len(w.Recipients))
+	}
+	return "identity"
+}
+
+// twoFactorAccountType protects TWOFACTOR accounts with a passphrase and the
+// recipients of an identity file.
+type twoFactorAccountType struct{}
+
+func (twoFactorAccountType) Name() string { return "twofactor" }
+
+func (twoFactorAccountType) Encrypt(s *Store, account *nkn.Account, key AccountKey) (*Wallet, error) {
+	recipients, err := identityRecipients(s, key)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := s.newKeyPassphrase(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.encryptTwoFactor(account, recipients, pass)
+}
+
+func (twoFactorAccountType) Decrypt(s *Store, w *Wallet, key AccountKey) (*nkn.Account, error) {
+	if len(key.Identity) == 0 {
+		return nil, errors.New("Wallet is a two-factor account. Use its identity file together with its passphrase to decrypt it.")
+	}
+	account, inner, err := decryptAccountTwoFactor(w, key.Identity, s.keyPassphraseProvider(key))
+	if err != nil {
+		return nil, err
+	}
+	w.inner = inner
+	return account, nil
+}
+
+func (twoFactorAccountType) Rekey(s *Store, w *Wallet, key AccountKey) error {
+	return s.setTwoFactorPassphrase(w, key)
+}
+
+func (twoFactorAccountType) Describe(w *Wallet) string {
+	if n := w.ScryptWorkFactor(); n > 0 {
+		return fmt.Sprintf("identity and passphrase (scrypt %d)", n)
+	}
+	return "identity and passphrase"
+}
+
+// watchAccountType stands for WATCH accounts, which hold no key.
+type watchAccountType struct{}
+
+func (watchAccountType) Name() string { return "watch" }
+
+func (watchAccountType) Encrypt(s *Store, account *nkn.Account, key AccountKey) (*Wallet, error) {
+	return nil, errors.New("Watch-only accounts hold no key. Use AddWatch to add one.")
+}
+
+func (watchAccountType) Decrypt(s *Store, w *Wallet, key AccountKey) (*nkn.Account, error) {
+	return nil, WatchOnlyError{w.Address()}
+}
+
+func (watchAccountType) Rekey(s *Store, w *Wallet, key AccountKey) error {
+	return WatchOnlyError{w.Address()}
+}
+
+func (watchAccountType) Describe(w *Wallet) string {
+	return "watch-only"
+}
+
+// externalAccountType stands for EXTERNAL accounts, whose key is kept by an
+// external signer.
+type externalAccountType struct{}
+
+func (externalAccountType) Name() string { return "external" }
+
+func (externalAccountType) Encrypt(s *Store, account *nkn.Account, key AccountKey) (*Wallet, error) {
+	return nil, errors.New("External accounts hold no key. Use AddExternal to add one.")
+}
+
+func (externalAccountType) Decrypt(s *Store, w *Wallet, key AccountKey) (*nkn.Account, error) {
+	return nil, ExternalSignerError{w.Address()}
+}
+
+func (externalAccountType) Rekey(s *Store, w *Wallet, key AccountKey) error {
+	return ExternalSignerError{w.Address()}
+}
+
+func (externalAccountType) Describe(w *Wallet) string {
+	if w.ExternalSigner == nil {
+		return "external signer"
+	}
+	return "signer " + w.ExternalSigner.String()
+}
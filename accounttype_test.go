@@ -0,0 +1,122 @@
+package nknwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+// plainAccountType stores seeds unencrypted, to test registering account
+// types.
+type plainAccountType struct{ name string }
+
+func (t plainAccountType) Name() string { return t.name }
+
+func (t plainAccountType) Encrypt(s *Store, account *nkn.Account, key AccountKey) (*Wallet, error) {
+	return &Wallet{Type: t.name, Armor: hex.EncodeToString(account.Seed())}, nil
+}
+
+func (plainAccountType) Decrypt(s *Store, w *Wallet, key AccountKey) (*nkn.Account, error) {
+	seed, err := hex.DecodeString(w.Armor)
+	if err != nil {
+		return nil, err
+	}
+	return nkn.NewAccount(seed)
+}
+
+func (plainAccountType) Rekey(s *Store, w *Wallet, key AccountKey) error { return nil }
+
+func (plainAccountType) Describe(w *Wallet) string { return "plain" }
+
+// registerPlain registers plainAccountType once, also when tests run
+// repeatedly.
+var registerPlain sync.Once
+
+func TestRegisterAccountType(t *testing.T) {
+	registerPlain.Do(func() { RegisterAccountType(plainAccountType{name: "TEST-PLAIN"}) })
+	if _, err := LookupAccountType("test-plain"); err != nil {
+		t.Fatal(err)
+	}
+	if indexOf(AccountTypes(), "test-plain") < 0 {
+		t.Fatalf("AccountTypes() = %q, want test-plain among them", AccountTypes())
+	}
+
+	s, err := NewStore("", WithBackend(NewMemBackend()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := s.NewWallet("test-plain", AccountKey{}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveWallet(w); err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.DecryptWallet(w.ID, AccountKey{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.Seed(), w.Seed()) || d.Describe() != "plain" {
+		t.Fatalf("account of a registered type decrypted to %s (%s)", d.Address(), d.Describe())
+	}
+}
+
+func TestRegisterAccountTypePanics(t *testing.T) {
+	for _, name := range []string{"", "scrypt", "IDENTITY"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterAccountType(%q) did not panic", name)
+				}
+			}()
+			RegisterAccountType(plainAccountType{name: name})
+		}()
+	}
+}
+
+func TestRekeyRecipientsAccount(t *testing.T) {
+	dir := t.TempDir()
+	identity, _ := writeIdentity(t, dir, "old.txt")
+	newIdentity, newID := writeIdentity(t, dir, "new.txt")
+	recipientFile := filepath.Join(dir, "recipients.txt")
+	if err := os.WriteFile(recipientFile, []byte(newID.Recipient().String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStore("", WithBackend(NewMemBackend()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := s.NewWallet("identity", AccountKey{Identity: identity}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveWallet(w); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RekeyWallet(w, AccountKey{}); err == nil {
+		t.Fatal("RekeyWallet without recipients succeeded")
+	}
+	if err := s.RekeyWallet(w, AccountKey{RecipientFile: recipientFile}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DecryptWallet(w.ID, AccountKey{Identity: identity}, nil); err == nil {
+		t.Fatal("account rekeyed to a recipients file still decrypts with the old identity")
+	}
+	if _, err := s.DecryptWallet(w.ID, AccountKey{Identity: newIdentity}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RekeyWallet(w, AccountKey{Recipient: newID.Recipient().String()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DecryptWallet(w.ID, AccountKey{Identity: newIdentity}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,401 @@
+package nknwallet
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nknorg/nkn-sdk-go"
+	"github.com/nknorg/nkn/v2/signature"
+	"github.com/nknorg/nkn/v2/transaction"
+)
+
+// An agent holds decrypted accounts in memory, in the spirit of ssh-agent, so
+// transactions can be signed without decrypting the account every time. It
+// serves requests on a Unix socket; the seeds never leave the agent again.
+// Requests and responses are JSON lines, one request per connection.
+
+// AgentSocketEnv is the environment variable holding the socket of a running
+// agent.
+const AgentSocketEnv = "NKN_WALLET_AGENT_SOCK"
+
+// DefaultAgentTimeout is how long an agent keeps an unused account.
+const DefaultAgentTimeout = 15 * time.Minute
+
+// ErrAgentKeyNotFound is returned when the agent doesn't hold the account
+// asked for.
+var ErrAgentKeyNotFound = errors.New("Account is not held by the agent.")
+
+// AgentKey describes an account held by an agent.
+type AgentKey struct {
+	Address string `json:"address"`
+	PubKey  []byte `json:"pubkey"`
+	// Comment is a free text set when the account was added, e.g. the
+	// wallet file and index it was decrypted from.
+	Comment string `json:"comment,omitempty"`
+	// Timeout is how long the account is kept without being used, zero for
+	// as long as the agent runs.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Expires is when the account is forgotten unless it is used before.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+type agentRequest struct {
+	Op      string        `json:"op"`
+	Address string        `json:"address,omitempty"`
+	Seed    []byte        `json:"seed,omitempty"`
+	Comment string        `json:"comment,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+	Tx      []byte        `json:"tx,omitempty"`
+}
+
+type agentResponse struct {
+	Error     string     `json:"error,omitempty"`
+	Keys      []AgentKey `json:"keys,omitempty"`
+	Signature []byte     `json:"signature,omitempty"`
+}
+
+type agentKey struct {
+	account *nkn.Account
+	comment string
+	timeout time.Duration
+	timer   *time.Timer
+	expires time.Time
+}
+
+// Agent holds decrypted accounts and signs transactions with them. Accounts
+// are forgotten after being unused for their timeout.
+type Agent struct {
+	mu   sync.Mutex
+	keys map[string]*agentKey
+}
+
+// NewAgent returns an agent holding no accounts.
+func NewAgent() *Agent {
+	return &Agent{keys: map[string]*agentKey{}}
+}
+
+// ListenAgent listens on the Unix socket path, readable only by the current
+// user. A stale socket left behind by an agent that died is replaced.
+func ListenAgent(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("An agent is listening on %s already.", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve answers requests on l until it is closed.
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go a.handle(conn)
+	}
+}
+
+func (a *Agent) handle(conn net.Conn) {
+	defer conn.Close()
+	var req agentRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+	defer zero(req.Seed)
+
+	var resp agentResponse
+	var err error
+	switch req.Op {
+	case "add":
+		var account *nkn.Account
+		account, err = nkn.NewAccount(req.Seed)
+		if err == nil {
+			a.Add(account, req.Comment, req.Timeout)
+		}
+	case "list":
+		resp.Keys = a.Keys()
+	case "remove":
+		if !a.Remove(req.Address) {
+			err = ErrAgentKeyNotFound
+		}
+	case "lock":
+		a.Lock()
+	case "sign":
+		tx := &transaction.Transaction{}
+		if err = tx.Unmarshal(req.Tx); err == nil {
+			resp.Signature, err = a.Sign(req.Address, tx)
+		}
+	default:
+		err = fmt.Errorf("Unknown agent request %q.", req.Op)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// Add adds account to the agent, replacing it if it is held already. It is
+// forgotten after being unused for timeout, or kept until it is removed if
+// timeout is zero.
+func (a *Agent) Add(account *nkn.Account, comment string, timeout time.Duration) {
+	address := account.WalletAddress()
+	k := &agentKey{account: account, comment: comment, timeout: timeout}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.forget(address)
+	if timeout > 0 {
+		k.expires = time.Now().Add(timeout)
+		k.timer = time.AfterFunc(timeout, func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			// Sign may have restarted the timeout while this call waited
+			// for the lock; the restarted timer calls it again.
+			if a.keys[address] != k || time.Now().Before(k.expires) {
+				return
+			}
+			a.forget(address)
+		})
+	}
+	a.keys[address] = k
+}
+
+// Remove removes the account with address from the agent. It reports whether
+// the account was held.
+func (a *Agent) Remove(address string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.forget(address)
+}
+
+// Lock removes all accounts from the agent.
+func (a *Agent) Lock() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for address := range a.keys {
+		a.forget(address)
+	}
+}
+
+// forget removes an account and wipes its private key. a.mu must be held.
+func (a *Agent) forget(address string) bool {
+	k, ok := a.keys[address]
+	if !ok {
+		return false
+	}
+	if k.timer != nil {
+		k.timer.Stop()
+	}
+	zero(k.account.PrivateKey)
+	delete(a.keys, address)
+	return true
+}
+
+// Keys returns the accounts held by the agent, sorted by address.
+func (a *Agent) Keys() []AgentKey {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keys := []AgentKey{}
+	for address, k := range a.keys {
+		keys = append(keys, AgentKey{
+			Address: address,
+			PubKey:  k.account.PubKey(),
+			Comment: k.comment,
+			Timeout: k.timeout,
+			Expires: k.expires,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Address < keys[j].Address })
+	return keys
+}
+
+// Sign signs tx with the account with address and restarts its timeout.
+func (a *Agent) Sign(address string, tx *transaction.Transaction) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	k, ok := a.keys[address]
+	if !ok {
+		return nil, ErrAgentKeyNotFound
+	}
+	k.touch()
+	return signature.SignBySigner(tx, k.account.Account)
+}
+
+// touch restarts the timeout of k. a.mu must be held.
+func (k *agentKey) touch() {
+	if k.timer != nil {
+		k.expires = time.Now().Add(k.timeout)
+		k.timer.Reset(k.timeout)
+	}
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// AgentClient talks to an agent listening on a Unix socket.
+type AgentClient struct {
+	path string
+}
+
+// NewAgentClient returns a client of the agent listening on path.
+func NewAgentClient(path string) *AgentClient {
+	return &AgentClient{path: path}
+}
+
+// AgentClientFromEnv returns a client of the agent named by AgentSocketEnv, or
+// nil if it is not set.
+func AgentClientFromEnv() *AgentClient {
+	path := os.Getenv(AgentSocketEnv)
+	if len(path) == 0 {
+		return nil
+	}
+	return NewAgentClient(path)
+}
+
+// Path returns the socket of the agent.
+func (c *AgentClient) Path() string {
+	return c.path
+}
+
+func (c *AgentClient) call(req agentRequest) (*agentResponse, error) {
+	conn, err := net.Dial("unix", c.path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to agent: %v", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("Could not send request to agent: %v", err)
+	}
+	var resp agentResponse
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("Could not read response of agent: %v", err)
+	}
+	if len(resp.Error) > 0 {
+		if resp.Error == ErrAgentKeyNotFound.Error() {
+			return nil, ErrAgentKeyNotFound
+		}
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// Add adds account to the agent. See Agent.Add.
+func (c *AgentClient) Add(account *nkn.Account, comment string, timeout time.Duration) error {
+	seed := account.Seed()
+	defer zero(seed)
+	_, err := c.call(agentRequest{Op: "add", Seed: seed, Comment: comment, Timeout: timeout})
+	return err
+}
+
+// List returns the accounts held by the agent.
+func (c *AgentClient) List() ([]AgentKey, error) {
+	resp, err := c.call(agentRequest{Op: "list"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// Key returns the account with address held by the agent, or
+// ErrAgentKeyNotFound.
+func (c *AgentClient) Key(address string) (*AgentKey, error) {
+	keys, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].Address == address {
+			return &keys[i], nil
+		}
+	}
+	return nil, ErrAgentKeyNotFound
+}
+
+// Remove removes the account with address from the agent.
+func (c *AgentClient) Remove(address string) error {
+	_, err := c.call(agentRequest{Op: "remove", Address: address})
+	return err
+}
+
+// Lock removes all accounts from the agent.
+func (c *AgentClient) Lock() error {
+	_, err := c.call(agentRequest{Op: "lock"})
+	return err
+}
+
+// Sign returns the signature of tx by the account with address.
+func (c *AgentClient) Sign(address string, tx *transaction.Transaction) ([]byte, error) {
+	dat, err := tx.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.call(agentRequest{Op: "sign", Address: address, Tx: dat})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+// agentSigner signs for an account held by an agent.
+type agentSigner struct {
+	client  *AgentClient
+	address string
+	pubKey  []byte
+}
+
+// Signer returns a signer for the account with address held by the agent.
+func (c *AgentClient) Signer(address string) (Signer, error) {
+	key, err := c.Key(address)
+	if err != nil {
+		return nil, err
+	}
+	return &agentSigner{client: c, address: address, pubKey: key.PubKey}, nil
+}
+
+func (s *agentSigner) PubKey() []byte {
+	return s.pubKey
+}
+
+func (s *agentSigner) Sign(tx *transaction.Transaction) ([]byte, error) {
+	return s.client.Sign(s.address, tx)
+}
+
+// NewWalletByAgent returns the account with index signing through the agent
+// instead of being decrypted. Its seed is not available.
+func (s *Store) NewWalletByAgent(agent *AgentClient, index int, config *nkn.WalletConfig) (*Wallet, error) {
+	w, err := s.GetWalletByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := agent.Signer(w.Address())
+	if err != nil {
+		return nil, err
+	}
+	return s.NewWalletBySigner(signer, index, config)
+}
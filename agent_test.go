@@ -0,0 +1,138 @@
+package nknwallet
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nknorg/nkn-sdk-go"
+	"github.com/nknorg/nkn/v2/transaction"
+)
+
+func TestAgentTimeoutRestartedWhileExpiring(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	account, err := nkn.NewAccount(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := account.WalletAddress()
+	a := NewAgent()
+	a.Add(account, "", timeout)
+
+	// Hold the lock until the timeout fired, so its callback waits for it,
+	// and restart the timeout like Sign does meanwhile.
+	a.mu.Lock()
+	time.Sleep(2 * timeout)
+	a.keys[address].touch()
+	a.mu.Unlock()
+
+	time.Sleep(timeout / 2)
+	if len(a.Keys()) != 1 {
+		t.Fatal("account was forgotten right after its timeout was restarted")
+	}
+	time.Sleep(timeout)
+	if len(a.Keys()) != 0 {
+		t.Fatal("account was not forgotten after the restarted timeout")
+	}
+}
+
+func TestAgentSocket(t *testing.T) {
+	// Unix socket paths are short, so don't use the long t.TempDir()
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+	l, err := ListenAgent(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- NewAgent().Serve(l) }()
+	defer func() {
+		l.Close()
+		if err := <-served; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+	if _, err := ListenAgent(path); err == nil {
+		t.Fatal("second agent listens on the socket of a running one")
+	}
+
+	b := NewMemBackend()
+	s, err := NewStore("", WithBackend(b), WithScryptWorkFactor(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := s.NewWallet("scrypt", AccountKey{Passphrase: "test"}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveWallet(w); err != nil {
+		t.Fatal(err)
+	}
+	// a fresh store holds no decrypted account to fall back to
+	if s, err = NewStore("", WithBackend(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewAgentClient(path)
+	if _, err := s.NewWalletByAgent(c, w.ID, nil); !errors.Is(err, ErrAgentKeyNotFound) {
+		t.Fatalf("NewWalletByAgent before adding = %v, want ErrAgentKeyNotFound", err)
+	}
+	if err := c.Add(w.Account(), "test", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Address != w.Address() || keys[0].Comment != "test" || !bytes.Equal(keys[0].PubKey, w.PubKey()) {
+		t.Fatalf("List() = %+v, want the added account", keys)
+	}
+
+	aw, err := s.NewWalletByAgent(c, w.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aw.Seed() != nil {
+		t.Fatal("wallet signing through the agent has a seed")
+	}
+	if _, err := aw.Mnemonic(); !errors.Is(err, ErrSeedUnavailable) {
+		t.Fatalf("Mnemonic() = %v, want ErrSeedUnavailable", err)
+	}
+	recipient, err := nkn.NewAccount(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := transaction.NewTransferAssetTransaction(aw.ProgramHash(), recipient.ProgramHash, 1, 100000000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.SignTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.VerifySignature(); err != nil {
+		t.Fatalf("transaction signed by the agent doesn't verify: %v", err)
+	}
+
+	if err := c.Remove(w.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Sign(w.Address(), tx); err == nil {
+		t.Fatal("agent signed with a removed account")
+	}
+	if err := c.Add(w.Account(), "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := c.List(); err != nil || len(keys) != 0 {
+		t.Fatalf("List() after Lock = %+v, %v, want no accounts", keys, err)
+	}
+}
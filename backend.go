@@ -0,0 +1,64 @@
+package nknwallet
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Backend persists the content of a Store.
+type Backend interface {
+	// Load returns the stored envelope as it was written, without migrating
+	// it. A backend that holds no data yet returns NewEnvelope().
+	Load() (*Envelope, error)
+	// Save replaces the stored envelope with e.
+	Save(e *Envelope) error
+	// List returns the IDs of the stored accounts.
+	List() ([]int, error)
+	// Lock acquires a shared or exclusive lock on the backend, waiting at
+	// most timeout. A timeout of zero waits indefinitely. The returned
+	// function releases the lock.
+	Lock(exclusive bool, timeout time.Duration) (func() error, error)
+}
+
+// OpenBackend returns the backend for a wallet location. Supported locations
+// are a plain file path or "file://path" for a single JSON file,
+// "dir://path" for a directory with one metadata file and one armored file
+// per account and "mem://name" for an in-memory backend shared by all stores
+// of the process opened with the same name. backups is the number of backup
+// generations kept by the file backend.
+func OpenBackend(location string, backups int) (Backend, error) {
+	if len(location) == 0 {
+		return nil, errors.New("Need a file path for the wallet.")
+	}
+
+	switch {
+	case strings.HasPrefix(location, "mem://"):
+		return memBackendByName(strings.TrimPrefix(location, "mem://")), nil
+	case strings.HasPrefix(location, "dir://"):
+		dir := strings.TrimPrefix(location, "dir://")
+		if len(dir) == 0 {
+			return nil, errors.New("Need a directory path for the wallet.")
+		}
+		return NewDirBackend(dir), nil
+	case strings.HasPrefix(location, "file://"):
+		location = strings.TrimPrefix(location, "file://")
+		if len(location) == 0 {
+			return nil, errors.New("Need a file path for the wallet.")
+		}
+	case strings.Contains(location, "://"):
+		return nil, errors.New("Unknown wallet location scheme. Use a file path, file://, dir:// or mem://.")
+	}
+
+	b := NewFileBackend(location)
+	b.Backups = backups
+	return b, nil
+}
+
+func accountIDs(accounts []*Wallet) []int {
+	ids := make([]int, 0, len(accounts))
+	for _, w := range accounts {
+		ids = append(ids, w.ID)
+	}
+	return ids
+}
@@ -0,0 +1,217 @@
+package nknwallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirBackend stores a wallet in a directory: the store header in
+// "store.json", the metadata of every account in "accounts/<id>.json" and
+// its age armor in its own armored file "accounts/<id>.age", which age can
+// decrypt directly. Unchanged files are never rewritten, which keeps diffs
+// small when the directory is versioned with git, and their permissions are
+// preserved. Encrypted metadata is kept in "store.json".
+type DirBackend struct {
+	Dir string
+}
+
+var _ Backend = &DirBackend{}
+
+func NewDirBackend(dir string) *DirBackend {
+	return &DirBackend{Dir: dir}
+}
+
+func (b *DirBackend) headerPath() string {
+	return filepath.Join(b.Dir, "store.json")
+}
+
+func (b *DirBackend) accountsDir() string {
+	return filepath.Join(b.Dir, "accounts")
+}
+
+func (b *DirBackend) accountPath(id int) string {
+	return filepath.Join(b.accountsDir(), fmt.Sprintf("%d.json", id))
+}
+
+func (b *DirBackend) armorPath(id int) string {
+	return filepath.Join(b.accountsDir(), fmt.Sprintf("%d.age", id))
+}
+
+// dirHeader is the content of "store.json".
+type dirHeader struct {
+	Header StoreHeader `json:"header"`
+	Sealed string      `json:"sealed,omitempty"`
+}
+
+func (b *DirBackend) Load() (*Envelope, error) {
+	ids, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+
+	dat, err := os.ReadFile(b.headerPath())
+	if os.IsNotExist(err) && len(ids) == 0 {
+		return NewEnvelope(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h := &dirHeader{}
+	if err := json.Unmarshal(dat, h); err != nil {
+		return nil, fmt.Errorf("%q: %v", b.headerPath(), err)
+	}
+
+	e := &Envelope{Header: h.Header, Sealed: h.Sealed}
+	for _, id := range ids {
+		dat, err := os.ReadFile(b.accountPath(id))
+		if err != nil {
+			return nil, err
+		}
+		w := &Wallet{}
+		if err := json.Unmarshal(dat, w); err != nil {
+			return nil, fmt.Errorf("%q: %v", b.accountPath(id), err)
+		}
+		if w.ID != id {
+			return nil, fmt.Errorf("%q: account has ID %d", b.accountPath(id), w.ID)
+		}
+		// Directories written before armor files were split out keep the
+		// armor in the account file.
+		armor, err := os.ReadFile(b.armorPath(id))
+		if err == nil {
+			w.Armor = string(armor)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		e.Accounts = append(e.Accounts, w)
+	}
+	return e, nil
+}
+
+func (b *DirBackend) Save(e *Envelope) error {
+	if err := os.MkdirAll(b.accountsDir(), 0700); err != nil {
+		return err
+	}
+
+	dat, err := json.MarshalIndent(&dirHeader{Header: e.Header, Sealed: e.Sealed}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileIfChanged(b.headerPath(), dat); err != nil {
+		return err
+	}
+
+	keep := map[int]bool{}
+	for _, w := range e.Accounts {
+		dat, err := marshalAccountMetadata(w)
+		if err != nil {
+			return err
+		}
+		if err := writeFileIfChanged(b.accountPath(w.ID), dat); err != nil {
+			return err
+		}
+		if len(w.Armor) > 0 {
+			err = writeFileIfChanged(b.armorPath(w.ID), []byte(w.Armor))
+		} else {
+			err = removeIfExists(b.armorPath(w.ID))
+		}
+		if err != nil {
+			return err
+		}
+		keep[w.ID] = true
+	}
+
+	ids, err := b.List()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !keep[id] {
+			if err := os.Remove(b.accountPath(id)); err != nil {
+				return err
+			}
+			if err := removeIfExists(b.armorPath(id)); err != nil {
+				return err
+			}
+		}
+	}
+	syncDir(b.accountsDir())
+	return nil
+}
+
+func (b *DirBackend) List() ([]int, error) {
+	entries, err := os.ReadDir(b.accountsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (b *DirBackend) Lock(exclusive bool, timeout time.Duration) (func() error, error) {
+	if err := os.MkdirAll(b.Dir, 0700); err != nil {
+		return nil, err
+	}
+	l, err := lockFile(filepath.Join(b.Dir, ".lock"), exclusive, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return l.Unlock, nil
+}
+
+// marshalAccountMetadata returns the account file of w: w without its armor.
+func marshalAccountMetadata(w *Wallet) ([]byte, error) {
+	dat, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(dat, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "armor")
+	return json.MarshalIndent(fields, "", "  ")
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeFileIfChanged atomically writes dat to path unless path already holds
+// dat. The permissions of an existing file are kept, new files are created
+// readable by the owner only.
+func writeFileIfChanged(path string, dat []byte) error {
+	perm := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, dat) {
+			return nil
+		}
+	}
+	return writeFileAtomic(path, dat, perm)
+}
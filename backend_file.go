@@ -0,0 +1,113 @@
+package nknwallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileBackend stores a wallet in a single JSON file.
+type FileBackend struct {
+	Path string
+	// Backups is the number of backup generations kept next to the file.
+	Backups int
+}
+
+var _ Backend = &FileBackend{}
+
+// NewFileBackend returns a backend for the wallet file at path keeping
+// DefaultBackups backup generations.
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{
+		Path:    path,
+		Backups: DefaultBackups,
+	}
+}
+
+func (b *FileBackend) Load() (*Envelope, error) {
+	dat, err := os.ReadFile(b.Path)
+	if os.IsNotExist(err) {
+		return NewEnvelope(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return DecodeEnvelope(dat)
+}
+
+func (b *FileBackend) Save(e *Envelope) error {
+	dat, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(b.Path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	// a sealed wallet file must not leave plaintext metadata behind in its
+	// backups, so the plaintext file it replaces is not backed up
+	sealed := len(e.Sealed) > 0
+	if !sealed || isSealedFile(b.Path) {
+		if err := rotateBackups(b.Path, b.Backups); err != nil {
+			return fmt.Errorf("could not back up wallet file: %v", err)
+		}
+	}
+	if err := writeFileAtomic(b.Path, dat, perm); err != nil {
+		return err
+	}
+	if sealed {
+		if err := removePlaintextBackups(b.Path); err != nil {
+			return fmt.Errorf("could not remove plaintext backups of wallet file: %v", err)
+		}
+	}
+	return nil
+}
+
+// isSealedFile reports whether the wallet file at path holds sealed metadata.
+func isSealedFile(path string) bool {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	e, err := DecodeEnvelope(dat)
+	return err == nil && len(e.Sealed) > 0
+}
+
+// removePlaintextBackups overwrites and removes the backup generations of
+// path holding plaintext metadata.
+func removePlaintextBackups(path string) error {
+	backups, err := filepath.Glob(path + ".bak.*")
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups {
+		if isSealedFile(backup) {
+			continue
+		}
+		if err := scrubFile(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *FileBackend) List() ([]int, error) {
+	e, err := b.Load()
+	if err != nil {
+		return nil, err
+	}
+	return accountIDs(e.Accounts), nil
+}
+
+// Lock locks a separate ".lock" file, because Save replaces the wallet file
+// by renaming.
+func (b *FileBackend) Lock(exclusive bool, timeout time.Duration) (func() error, error) {
+	l, err := lockFile(b.Path+".lock", exclusive, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return l.Unlock, nil
+}
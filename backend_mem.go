@@ -0,0 +1,84 @@
+package nknwallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	memBackendsMu sync.Mutex
+	memBackends   = map[string]*MemBackend{}
+)
+
+// memBackendByName returns the in-memory backend registered under name,
+// creating it on first use.
+func memBackendByName(name string) *MemBackend {
+	memBackendsMu.Lock()
+	defer memBackendsMu.Unlock()
+	b, ok := memBackends[name]
+	if !ok {
+		b = NewMemBackend()
+		memBackends[name] = b
+	}
+	return b
+}
+
+// MemBackend keeps a wallet in memory. It is meant for tests and throwaway
+// stores; nothing survives the process.
+type MemBackend struct {
+	lock sync.RWMutex
+	mu   sync.Mutex
+	dat  []byte
+}
+
+var _ Backend = &MemBackend{}
+
+func NewMemBackend() *MemBackend {
+	return &MemBackend{}
+}
+
+// Load returns a copy of the stored envelope, so stores never share account
+// state through the backend.
+func (b *MemBackend) Load() (*Envelope, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return DecodeEnvelope(b.dat)
+}
+
+func (b *MemBackend) Save(e *Envelope) error {
+	dat, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dat = dat
+	return nil
+}
+
+func (b *MemBackend) List() ([]int, error) {
+	e, err := b.Load()
+	if err != nil {
+		return nil, err
+	}
+	return accountIDs(e.Accounts), nil
+}
+
+func (b *MemBackend) Lock(exclusive bool, timeout time.Duration) (func() error, error) {
+	try, unlock := b.lock.TryRLock, b.lock.RUnlock
+	if exclusive {
+		try, unlock = b.lock.TryLock, b.lock.Unlock
+	}
+	err := acquireLock(fmt.Sprintf("memory backend %p", b), timeout, func() (bool, error) {
+		return try(), nil
+	}, func() string { return "" })
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		unlock()
+		return nil
+	}, nil
+}
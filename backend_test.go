@@ -0,0 +1,299 @@
+package nknwallet
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBackends(t *testing.T) map[string]Backend {
+	dir := t.TempDir()
+	return map[string]Backend{
+		"mem":  NewMemBackend(),
+		"file": NewFileBackend(filepath.Join(dir, "wallet.json")),
+		"dir":  NewDirBackend(filepath.Join(dir, "wallet")),
+	}
+}
+
+func testEnvelope() *Envelope {
+	e := NewEnvelope()
+	e.Header.Settings.ScryptWorkFactor = 15
+	e.Accounts = []*Wallet{
+		{ID: 1, Type: "SCRYPT", NKNAddress: "NKNTvYoLtzvoQU5wftsAmEovBQQ54Gqi8HUT", Armor: "-----BEGIN AGE ENCRYPTED FILE-----\nYWdl\n-----END AGE ENCRYPTED FILE-----\n", Alias: "cold"},
+		{ID: 2, Type: "WATCH", NKNAddress: "NKNY1DjDmHc9Ejq3KMXychfYiEkN9A9PG4kj"},
+		{ID: 5, Type: "IDENTITY", NKNAddress: "NKNTvYoLtzvoQU5wftsAmEovBQQ54Gqi8HUT", Armor: "armor 5", Recipients: []string{"age1x"}},
+	}
+	return e
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	dat, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(dat)
+}
+
+func TestBackendLoadSave(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			e, err := b.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Header.Version != StoreFormatVersion || len(e.Accounts) != 0 {
+				t.Fatalf("empty backend loaded %+v", e)
+			}
+			ids, err := b.List()
+			if err != nil || len(ids) != 0 {
+				t.Fatalf("List() = %v, %v, want no accounts", ids, err)
+			}
+
+			want := testEnvelope()
+			if err := b.Save(want); err != nil {
+				t.Fatal(err)
+			}
+			got, err := b.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mustJSON(t, got) != mustJSON(t, want) {
+				t.Fatalf("Load() = %s, want %s", mustJSON(t, got), mustJSON(t, want))
+			}
+			ids, err = b.List()
+			if err != nil || !reflect.DeepEqual(ids, []int{1, 2, 5}) {
+				t.Fatalf("List() = %v, %v, want [1 2 5]", ids, err)
+			}
+
+			want.Accounts = want.Accounts[:1]
+			want.Accounts[0].Alias = "renamed"
+			if err := b.Save(want); err != nil {
+				t.Fatal(err)
+			}
+			got, err = b.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mustJSON(t, got) != mustJSON(t, want) {
+				t.Fatalf("Load() = %s, want %s", mustJSON(t, got), mustJSON(t, want))
+			}
+			ids, err = b.List()
+			if err != nil || !reflect.DeepEqual(ids, []int{1}) {
+				t.Fatalf("List() = %v, %v, want [1]", ids, err)
+			}
+		})
+	}
+}
+
+func TestBackendLoadReturnsCopy(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := b.Save(testEnvelope()); err != nil {
+				t.Fatal(err)
+			}
+			e, err := b.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.Accounts[0].Alias = "changed"
+			e, err = b.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Accounts[0].Alias != "cold" {
+				t.Fatalf("change of a loaded account reached the backend")
+			}
+		})
+	}
+}
+
+func TestBackendLock(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			unlock, err := b.Lock(true, timeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, exclusive := range []bool{true, false} {
+				_, err := b.Lock(exclusive, timeout)
+				if !errors.As(err, &LockTimeoutError{}) {
+					t.Fatalf("Lock(%v) while locked exclusively = %v, want LockTimeoutError", exclusive, err)
+				}
+			}
+			if err := unlock(); err != nil {
+				t.Fatal(err)
+			}
+
+			unlock1, err := b.Lock(false, timeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unlock2, err := b.Lock(false, timeout)
+			if err != nil {
+				t.Fatalf("second shared lock: %v", err)
+			}
+			if _, err := b.Lock(true, timeout); !errors.As(err, &LockTimeoutError{}) {
+				t.Fatalf("Lock(true) while shared = %v, want LockTimeoutError", err)
+			}
+			unlock1()
+			unlock2()
+
+			unlock, err = b.Lock(true, timeout)
+			if err != nil {
+				t.Fatalf("Lock(true) after unlocking: %v", err)
+			}
+			unlock()
+		})
+	}
+}
+
+func TestDirBackendArmorFiles(t *testing.T) {
+	b := NewDirBackend(t.TempDir())
+	e := testEnvelope()
+	if err := b.Save(e); err != nil {
+		t.Fatal(err)
+	}
+
+	armor, err := os.ReadFile(b.armorPath(1))
+	if err != nil || string(armor) != e.Accounts[0].Armor {
+		t.Fatalf("armor file of account 1 = %q, %v, want its armor", armor, err)
+	}
+	meta, err := os.ReadFile(b.accountPath(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(meta), "armor") || !strings.Contains(string(meta), `"alias": "cold"`) {
+		t.Fatalf("account file of account 1 = %s, want its metadata without armor", meta)
+	}
+	if _, err := os.Stat(b.armorPath(2)); !os.IsNotExist(err) {
+		t.Fatalf("WATCH account without armor has an armor file: %v", err)
+	}
+
+	// unchanged files are not rewritten
+	fi, err := os.Stat(b.armorPath(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(b.armorPath(5), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Save(e); err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := os.Stat(b.armorPath(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi2.ModTime().Equal(fi.ModTime()) || fi2.Mode().Perm() != 0640 {
+		t.Fatalf("unchanged armor file was rewritten")
+	}
+
+	e.Accounts = e.Accounts[1:2]
+	if err := b.Save(e); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{b.accountPath(1), b.armorPath(1), b.accountPath(5), b.armorPath(5)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s of a removed account still exists: %v", path, err)
+		}
+	}
+}
+
+func TestDirBackendLoadsArmorFromAccountFile(t *testing.T) {
+	b := NewDirBackend(t.TempDir())
+	if err := b.Save(NewEnvelope()); err != nil {
+		t.Fatal(err)
+	}
+	legacy := `{"id": 3, "type": "SCRYPT", "address": "NKNTvYoLtzvoQU5wftsAmEovBQQ54Gqi8HUT", "armor": "old armor"}`
+	if err := os.WriteFile(b.accountPath(3), []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := b.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Accounts) != 1 || e.Accounts[0].Armor != "old armor" {
+		t.Fatalf("Load() = %s, want the armor of the account file", mustJSON(t, e.Accounts))
+	}
+	if err := b.Save(e); err != nil {
+		t.Fatal(err)
+	}
+	armor, err := os.ReadFile(b.armorPath(3))
+	if err != nil || string(armor) != "old armor" {
+		t.Fatalf("armor file = %q, %v, want the armor moved out of the account file", armor, err)
+	}
+}
+
+func TestOpenBackend(t *testing.T) {
+	tests := []struct {
+		location string
+		want     Backend
+		err      bool
+	}{
+		{location: "", err: true},
+		{location: "wallet.json", want: &FileBackend{Path: "wallet.json", Backups: 3}},
+		{location: "/var/lib/nkn/wallet.json", want: &FileBackend{Path: "/var/lib/nkn/wallet.json", Backups: 3}},
+		{location: "file:///var/lib/nkn/wallet.json", want: &FileBackend{Path: "/var/lib/nkn/wallet.json", Backups: 3}},
+		{location: "file://wallet.json", want: &FileBackend{Path: "wallet.json", Backups: 3}},
+		{location: "file://", err: true},
+		{location: "dir:///var/lib/nkn/wallet", want: &DirBackend{Dir: "/var/lib/nkn/wallet"}},
+		{location: "dir://wallet", want: &DirBackend{Dir: "wallet"}},
+		{location: "dir://", err: true},
+		{location: "mem://test-open-backend", want: memBackendByName("test-open-backend")},
+		{location: "s3://bucket/wallet", err: true},
+	}
+	for _, tt := range tests {
+		got, err := OpenBackend(tt.location, 3)
+		if tt.err {
+			if err == nil {
+				t.Errorf("OpenBackend(%q) = %#v, want error", tt.location, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("OpenBackend(%q): %v", tt.location, err)
+			continue
+		}
+		if _, ok := tt.want.(*MemBackend); ok {
+			if got != tt.want {
+				t.Errorf("OpenBackend(%q) returned another memory backend", tt.location)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("OpenBackend(%q) = %#v, want %#v", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestMemBackendSharedByName(t *testing.T) {
+	s1, err := NewStore("mem://test-shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s1.AddWatch("NKNTvYoLtzvoQU5wftsAmEovBQQ54Gqi8HUT", nil, "w"); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := NewStore("mem://test-shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s2.GetWallets()) != 1 {
+		t.Fatalf("second store of mem://test-shared has %d accounts, want 1", len(s2.GetWallets()))
+	}
+	s3, err := NewStore("mem://test-other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s3.GetWallets()) != 0 {
+		t.Fatalf("store of mem://test-other has %d accounts, want 0", len(s3.GetWallets()))
+	}
+}
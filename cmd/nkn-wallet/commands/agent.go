@@ -0,0 +1,245 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/jedib0t/go-pretty/text"
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Start an agent holding decrypted accounts for signing",
+	Long: `Start an agent holding decrypted accounts for signing, in the spirit of
+ssh-agent.
+
+The agent runs in the background and prints the shell commands to point the
+CLI at its socket:
+
+  eval "$(nkn-wallet agent)"
+
+Add accounts with "nkn-wallet agent add --index <n>". While ` + nknwallet.AgentSocketEnv + `
+is set, transfer, move and show balance/transactions sign with the accounts of
+the agent instead of decrypting them. Accounts unused for their timeout are
+forgotten. Commands needing the seed still decrypt the account.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAgent()
+	},
+}
+
+var agentAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Decrypt an account and add it to the agent",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		cmd.MarkFlagRequired("index")
+	},
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAgentAdd()
+	},
+}
+
+var agentListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the accounts held by the agent",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAgentList()
+	},
+}
+
+var agentRemoveCmd = &cobra.Command{
+	Use:   "remove [<address>]",
+	Short: "Remove an account from the agent",
+	Long:  `Remove the account with the address, or with --index, from the agent.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAgentRemove(args)
+	},
+}
+
+var agentLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Remove all accounts from the agent",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAgentLock()
+	},
+}
+
+var (
+	agentSocket     string
+	agentForeground bool
+	agentDetached   bool
+	agentTimeout    time.Duration
+)
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+
+	agentCmd.AddCommand(agentAddCmd)
+	agentCmd.AddCommand(agentListCmd)
+	agentCmd.AddCommand(agentRemoveCmd)
+	agentCmd.AddCommand(agentLockCmd)
+
+	agentCmd.Flags().StringVar(&agentSocket, "socket", "", "Listen on this Unix socket instead of one in a new temporary directory.")
+	agentCmd.Flags().BoolVarP(&agentForeground, "foreground", "D", false, "Don't go to the background.")
+	agentCmd.Flags().BoolVar(&agentDetached, "detached", false, "")
+	agentCmd.Flags().MarkHidden("detached")
+
+	agentAddCmd.Flags().DurationVar(&agentTimeout, "timeout", nknwallet.DefaultAgentTimeout, "Forget the account after it is unused for this long (0 keeps it until removed).")
+}
+
+func runAgent() error {
+	if !agentForeground {
+		return startAgent()
+	}
+
+	if len(agentSocket) == 0 {
+		dir, err := os.MkdirTemp("", "nkn-wallet-agent-")
+		checkerr(err)
+		defer os.RemoveAll(dir)
+		agentSocket = filepath.Join(dir, "agent.sock")
+	}
+	l, err := nknwallet.ListenAgent(agentSocket)
+	checkerr(err)
+
+	agent := nknwallet.NewAgent()
+	defer agent.Lock()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		l.Close()
+	}()
+
+	fmt.Printf("%s=%s; export %s;\n", nknwallet.AgentSocketEnv, agentSocket, nknwallet.AgentSocketEnv)
+	fmt.Printf("echo Agent pid %d;\n", os.Getpid())
+	if agentDetached {
+		// let the parent see the end of the output and exit
+		os.Stdout.Close()
+	}
+	return agent.Serve(l)
+}
+
+// startAgent runs the agent as a detached child process and passes on the
+// shell commands it prints once it listens.
+func startAgent() error {
+	exe, err := os.Executable()
+	checkerr(err)
+
+	args := []string{"agent", "--foreground", "--detached"}
+	if len(agentSocket) > 0 {
+		args = append(args, "--socket", agentSocket)
+	}
+	child := exec.Command(exe, args...)
+	child.Stderr = os.Stderr
+	child.SysProcAttr = detachedProcAttr()
+	out, err := child.StdoutPipe()
+	checkerr(err)
+	checkerr(child.Start())
+
+	n, err := io.Copy(os.Stdout, out)
+	checkerr(err)
+	if n == 0 {
+		child.Wait()
+		cobra.CheckErr("Agent could not be started.")
+	}
+	return nil
+}
+
+// agentClient returns the client of the agent named by NKN_WALLET_AGENT_SOCK.
+func agentClient() *nknwallet.AgentClient {
+	client := nknwallet.AgentClientFromEnv()
+	if client == nil {
+		cobra.CheckErr(fmt.Sprintf("%s is not set. Start an agent with: eval \"$(nkn-wallet agent)\"", nknwallet.AgentSocketEnv))
+	}
+	return client
+}
+
+func runAgentAdd() error {
+	client := agentClient()
+
+	store, err := openStore()
+	checkerr(err)
+	wallet, err := getWallet(store, index)
+	checkerr(err)
+
+	comment := fmt.Sprintf("%s#%d", path, wallet.ID)
+	if len(wallet.Alias) > 0 {
+		comment += " " + wallet.Alias
+	}
+	checkerr(client.Add(wallet.Account(), comment, agentTimeout))
+
+	if agentTimeout > 0 {
+		fmt.Printf("Added account %d (%s) to the agent for %s after its last use.\n", wallet.ID, wallet.Address(), agentTimeout)
+	} else {
+		fmt.Printf("Added account %d (%s) to the agent until it is removed.\n", wallet.ID, wallet.Address())
+	}
+	return nil
+}
+
+func runAgentList() error {
+	keys, err := agentClient().List()
+	checkerr(err)
+
+	if len(keys) == 0 {
+		fmt.Println("Agent holds no accounts.")
+		return nil
+	}
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.Style().Options.DrawBorder = false
+	t.SetOutputMirror(os.Stdout)
+	t.SetAlign([]text.Align{text.AlignCenter, text.AlignCenter})
+	t.AppendHeader(table.Row{"address", "comment", "expires in"})
+	for _, k := range keys {
+		expires := "never"
+		if !k.Expires.IsZero() {
+			expires = time.Until(k.Expires).Round(time.Second).String()
+		}
+		t.AppendRow(table.Row{k.Address, k.Comment, expires})
+	}
+	t.Render()
+
+	return nil
+}
+
+func runAgentRemove(args []string) error {
+	client := agentClient()
+
+	var address string
+	if len(args) > 0 {
+		address = args[0]
+	} else if index > 0 {
+		store, err := openStore()
+		checkerr(err)
+		wallet, err := store.GetWalletByIndex(index)
+		checkerr(err)
+		address = wallet.Address()
+	} else {
+		cobra.CheckErr("Give the address of the account or its --index.")
+	}
+	checkerr(client.Remove(address))
+	fmt.Printf("Removed %s from the agent.\n", address)
+
+	return nil
+}
+
+func runAgentLock() error {
+	checkerr(agentClient().Lock())
+	fmt.Println("Removed all accounts from the agent.")
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package commands
+
+import "syscall"
+
+// detachedProcAttr starts the agent in a new session, so it outlives the shell
+// that started it and doesn't get its signals.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
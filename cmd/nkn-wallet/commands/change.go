@@ -1,8 +1,12 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
+	"filippo.io/age"
 	nknwallet "github.com/omani/nkn-wallet"
 	"github.com/spf13/cobra"
 )
@@ -33,8 +37,100 @@ var aliasCmd = &cobra.Command{
 	},
 }
 
+var metadataEncryptionCmd = &cobra.Command{
+	Use:   "metadata-encryption",
+	Short: "Encrypt the metadata (addresses, aliases) of all accounts in the wallet",
+	Long: `Encrypt the metadata (addresses, aliases) of all accounts in the wallet.
+
+The metadata is encrypted to the recipients of -r, -R or -i, or with a
+passphrase. They are recorded in the wallet and every later change is
+encrypted to them again, whoever makes it. Run this command again to change
+them.
+
+Metadata encrypted to recipients is decrypted with --metadata-identity, or
+else with the identity file of -i. Metadata encrypted with a passphrase is
+decrypted with the passphrase, whatever identity file is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChangeMetadataEncryption()
+	},
+}
+
+var recipientsCmd = &cobra.Command{
+	Use:   "recipients",
+	Short: "Change the recipients an account in the wallet is encrypted to",
+	Long: `Change the recipients an account in the wallet is encrypted to.
+
+The account is decrypted with the identity file (-i) or its passphrase and
+encrypted again to the new recipients; its seed never leaves the process.
+Recipients are age or SSH public keys or files of recipients.
+
+--add and --remove change the recipients recorded with the account. Accounts
+created before recipients were recorded are assumed to be encrypted to the
+identity used to decrypt them. --set replaces all recipients, which also
+converts a passphrase encrypted account. --to-password converts the account
+to a passphrase encrypted one. --to-recipient replaces all recipients with
+names of the recipient registry; the account is rekeyed again when a name
+changes.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		cmd.MarkFlagRequired("index")
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChangeRecipients()
+	},
+}
+
+var recoveryRecipientsCmd = &cobra.Command{
+	Use:   "recovery-recipients",
+	Short: "Change the recovery recipients every account in the wallet is also encrypted to",
+	Long: `Change the recovery recipients every account in the wallet is also encrypted to.
+
+Recovery recipients are break-glass keys: every account created or rekeyed
+afterwards is also encrypted to them. Passphrase encrypted accounts get a
+separate recovery armor. Existing accounts are not changed; use verify-policy
+to find accounts that don't satisfy the policy and rekey them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChangeRecoveryRecipients()
+	},
+}
+
+var scryptWorkFactorCmd = &cobra.Command{
+	Use:   "scrypt-work-factor <n>",
+	Short: "Change the default scrypt work factor of passphrases in the wallet",
+	Long: `Change the default scrypt work factor of passphrases in the wallet.
+
+The work factor is the base-2 logarithm of the scrypt cost: every step up
+doubles the time and memory needed to derive the key from a passphrase. Use a
+low factor on slow machines and a high one on hardened vault machines; 0
+resets it to the default of age. Existing accounts are not changed; use
+reharden to re-encrypt them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChangeScryptWorkFactor(args[0])
+	},
+}
+
+var keyServerCmd = &cobra.Command{
+	Use:   "key-server [<url>]",
+	Short: "Change the key server github:<user> recipients are fetched from",
+	Long: `Change the key server github:<user> recipients are fetched from.
+
+The SSH keys of a user are fetched from <url>/<user>.keys, which works with
+GitHub (the default), GitLab or an internal key server serving the same
+format. Without a URL the default is restored. Keys fetched before stay
+pinned; use "recipients unpin" to fetch them again.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runChangeKeyServer(args)
+	},
+}
+
 var (
-	newalias string
+	newalias                  string
+	disableMetadataEncryption bool
+	addRecipients             []string
+	removeRecipients          []string
+	setRecipients             []string
+	toPassword                bool
 )
 
 func init() {
@@ -42,12 +138,35 @@ func init() {
 
 	changeCmd.AddCommand(passwordCmd)
 	changeCmd.AddCommand(aliasCmd)
+	changeCmd.AddCommand(metadataEncryptionCmd)
+	changeCmd.AddCommand(recipientsCmd)
+	changeCmd.AddCommand(recoveryRecipientsCmd)
+	changeCmd.AddCommand(scryptWorkFactorCmd)
+	changeCmd.AddCommand(keyServerCmd)
 
 	changeCmd.PersistentFlags().StringVar(&newalias, "newalias", "", "New alias of account.")
+	metadataEncryptionCmd.Flags().BoolVar(&disableMetadataEncryption, "disable", false, "Store the metadata in plaintext again.")
+
+	recipientsCmd.Flags().StringArrayVar(&addRecipients, "add", nil, "Add a recipient. May be repeated.")
+	recipientsCmd.Flags().StringArrayVar(&removeRecipients, "remove", nil, "Remove a recipient. May be repeated.")
+	recipientsCmd.Flags().StringArrayVar(&setRecipients, "set", nil, "Replace all recipients. May be repeated.")
+	recipientsCmd.Flags().BoolVar(&toPassword, "to-password", false, "Encrypt the account with a passphrase instead of recipients.")
+
+	recoveryRecipientsCmd.Flags().StringArrayVar(&addRecipients, "add", nil, "Add a recovery recipient. May be repeated.")
+	recoveryRecipientsCmd.Flags().StringArrayVar(&removeRecipients, "remove", nil, "Remove a recovery recipient. May be repeated.")
+	recoveryRecipientsCmd.Flags().StringArrayVar(&setRecipients, "set", nil, "Replace all recovery recipients. May be repeated.")
+	recoveryRecipientsCmd.MarkFlagsMutuallyExclusive("set", "add")
+	recoveryRecipientsCmd.MarkFlagsMutuallyExclusive("set", "remove")
+
+	recipientsCmd.MarkFlagsMutuallyExclusive("set", "add")
+	recipientsCmd.MarkFlagsMutuallyExclusive("set", "remove")
+	recipientsCmd.MarkFlagsMutuallyExclusive("set", "to-password")
+	recipientsCmd.MarkFlagsMutuallyExclusive("add", "to-password")
+	recipientsCmd.MarkFlagsMutuallyExclusive("remove", "to-password")
 }
 
 func runChangePassword() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
 	wallet, err := getWallet(store, index)
 	checkerr(err)
@@ -58,8 +177,204 @@ func runChangePassword() error {
 	return nil
 }
 
+func runChangeRecipients() error {
+	edits := len(addRecipients) > 0 || len(removeRecipients) > 0 || len(setRecipients) > 0 || toPassword
+	if !edits && len(toNamed) == 0 {
+		cobra.CheckErr("Use --add, --remove, --set, --to-password or --to-recipient to choose the new recipients.")
+	}
+	if edits && len(toNamed) > 0 {
+		cobra.CheckErr("--to-recipient can't be combined with --add, --remove, --set or --to-password.")
+	}
+
+	store, err := openStore()
+	checkerr(err)
+	wallet, err := getWallet(store, index)
+	checkerr(err)
+
+	if len(toNamed) > 0 {
+		checkerr(store.RekeyToNamedRecipients(wallet, toNamed))
+		fmt.Printf("Account %d is encrypted to %s.\n", wallet.ID, strings.Join(toNamed, ", "))
+		return nil
+	}
+
+	if toPassword {
+		pass, err := store.PromptChangedPassword()
+		checkerr(err)
+		r, err := store.ScryptRecipient(pass)
+		checkerr(err)
+		checkerr(store.Rekey(wallet, []age.Recipient{r}))
+		fmt.Printf("Account %d is encrypted with a passphrase.\n", wallet.ID)
+		return nil
+	}
+
+	var names []string
+	if len(setRecipients) == 0 {
+		names, err = currentRecipients(store, wallet)
+		checkerr(err)
+	}
+	names, err = editRecipients(store, names, append(setRecipients, addRecipients...), removeRecipients)
+	checkerr(err)
+	if len(names) == 0 {
+		cobra.CheckErr("Can't remove all recipients of an account.")
+	}
+
+	var recipients []age.Recipient
+	for _, name := range names {
+		r, err := store.ParseRecipient(name)
+		checkerr(err)
+		recipients = append(recipients, r...)
+	}
+	checkerr(store.Rekey(wallet, recipients))
+
+	fmt.Printf("Account %d is encrypted to:\n", wallet.ID)
+	for _, name := range names {
+		fmt.Printf("  %s\n", name)
+	}
+	return nil
+}
+
+func runChangeRecoveryRecipients() error {
+	store, err := openStore()
+	checkerr(err)
+
+	names := store.RecoveryRecipients()
+	if len(setRecipients) > 0 {
+		names = nil
+	}
+	names, err = editRecipients(store, names, append(setRecipients, addRecipients...), removeRecipients)
+	checkerr(err)
+	checkerr(store.SetRecoveryRecipients(names))
+
+	if len(names) == 0 {
+		fmt.Println("Wallet has no recovery recipients.")
+		return nil
+	}
+	fmt.Println("Recovery recipients:")
+	for _, name := range names {
+		fmt.Printf("  %s\n", name)
+	}
+	fmt.Println("Existing accounts are not re-encrypted. Run verify-policy to find them.")
+	return nil
+}
+
+// editRecipients adds and removes recipients given on the command line to
+// and from names.
+func editRecipients(store *nknwallet.Store, names []string, add, remove []string) ([]string, error) {
+	for _, r := range add {
+		rs, err := recipientNames(store, r)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range rs {
+			if indexOf(names, name) < 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	for _, r := range remove {
+		rs, err := recipientNames(store, r)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range rs {
+			i := indexOf(names, name)
+			if i < 0 {
+				return nil, fmt.Errorf("%s is not a recipient.", name)
+			}
+			names = append(names[:i:i], names[i+1:]...)
+		}
+	}
+	return names, nil
+}
+
+// currentRecipients returns the recipients the account is encrypted to.
+func currentRecipients(store *nknwallet.Store, wallet *nknwallet.Wallet) ([]string, error) {
+	if strings.ToLower(wallet.Type) == "scrypt" {
+		return nil, errors.New("Account is encrypted with a passphrase. Use --set to encrypt it to recipients.")
+	}
+	if len(wallet.Recipients) > 0 {
+		return wallet.Recipients, nil
+	}
+	if len(ageIdentity) == 0 {
+		return nil, errors.New("Recipients of the account are unknown. Use --set to replace them.")
+	}
+	recipients, err := store.ParseIdentity(ageIdentity)
+	if err != nil {
+		return nil, err
+	}
+	return nknwallet.RecipientNames(recipients)
+}
+
+// recipientNames returns the canonical names of a recipient given on the
+// command line.
+func recipientNames(store *nknwallet.Store, r string) ([]string, error) {
+	recipients, err := parseRecipientArg(store, r)
+	if err != nil {
+		return nil, err
+	}
+	return nknwallet.RecipientNames(recipients)
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func runChangeScryptWorkFactor(arg string) error {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		cobra.CheckErr(fmt.Sprintf("Invalid work factor %s.", arg))
+	}
+
+	store, err := openStore()
+	checkerr(err)
+	checkerr(store.SetScryptWorkFactor(n))
+
+	if n == 0 {
+		n = nknwallet.DefaultScryptWorkFactor
+	}
+	fmt.Printf("New passphrases are encrypted with scrypt work factor %d.\n", n)
+	return nil
+}
+
+func runChangeKeyServer(args []string) error {
+	var server string
+	if len(args) > 0 {
+		server = args[0]
+	}
+
+	store, err := openStore()
+	checkerr(err)
+	checkerr(store.SetKeyServer(server))
+
+	if len(server) == 0 {
+		server = nknwallet.DefaultKeyServer
+	}
+	fmt.Printf("Keys of github:<user> recipients are fetched from %s/<user>.keys.\n", strings.TrimSuffix(server, "/"))
+	return nil
+}
+
+func runChangeMetadataEncryption() error {
+	store, err := openStore()
+	checkerr(err)
+
+	err = store.SetMetadataEncryption(!disableMetadataEncryption)
+	checkerr(err)
+
+	if disableMetadataEncryption {
+		fmt.Println("Wallet metadata is stored in plaintext.")
+	} else {
+		fmt.Println("Wallet metadata is encrypted. Plaintext backups of the wallet file were removed.")
+	}
+	return nil
+}
+
 func runChangeAlias() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
 
 	if len(alias) > 0 {
@@ -70,9 +385,13 @@ func runChangeAlias() error {
 	if ok := store.IsExistWalletByAlias(newalias); ok {
 		cobra.CheckErr(fmt.Sprintf("Account with alias %s already exists.", alias))
 	}
-	wallet, err := getWallet(store, index)
+	wallet, err := store.GetWalletByIndex(index)
 	checkerr(err)
-	store.SetAlias(wallet, newalias)
+	if !wallet.IsWatchOnly() && !wallet.IsExternal() {
+		wallet, err = getWallet(store, index)
+		checkerr(err)
+	}
+	err = store.SetAlias(wallet, newalias)
 	checkerr(err)
 
 	return nil
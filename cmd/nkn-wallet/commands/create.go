@@ -17,15 +17,21 @@ var createCmd = &cobra.Command{
 }
 
 var (
-	passwd string
-	alias  string
-	save   bool
+	passwd       string
+	alias        string
+	save         bool
+	showMnemonic bool
+	derive       bool
+	derivePath   string
 )
 
 func init() {
 	rootCmd.AddCommand(createCmd)
 
 	createCmd.Flags().BoolVarP(&save, "save", "s", false, "Save new account to wallet.")
+	createCmd.Flags().BoolVar(&showMnemonic, "mnemonic", false, "Also print the seed as 24-word BIP39 mnemonic.")
+	createCmd.Flags().BoolVar(&derive, "derive", false, "Derive the account from the master secret of the wallet (HD mode). The master secret is created when the first derived account is saved.")
+	createCmd.Flags().StringVar(&derivePath, "derivation-path", nknwallet.DefaultDerivationPath, "Path below which accounts are derived. Only used when the master secret is created.")
 }
 
 func checkerr(err error) {
@@ -35,20 +41,35 @@ func checkerr(err error) {
 }
 
 func runCreate() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
-	wallet, err := getWallet(store, index)
+	var wallet *nknwallet.Wallet
+	saveMaster := func() error { return nil }
+	if derive {
+		wallet, saveMaster, err = deriveWallet(store)
+	} else {
+		wallet, err = getWallet(store, index)
+	}
 	checkerr(err)
 
 	fmt.Println("Account information:")
 	fmt.Printf("ID: %d\n", wallet.ID)
 	fmt.Printf("Address: %s\n", wallet.Address())
+	if len(wallet.Path) > 0 {
+		fmt.Printf("Derivation path: %s\n", wallet.Path)
+	}
 	fmt.Printf("Seed: %s\n", hex.EncodeToString(wallet.Seed()))
+	if showMnemonic {
+		mnemonic, err := wallet.Mnemonic()
+		checkerr(err)
+		fmt.Printf("Mnemonic: %s\n", mnemonic)
+	}
 	if len(alias) > 0 {
 		fmt.Printf("Alias: %s\n", alias)
 	}
 
 	if save {
+		checkerr(saveMaster())
 		err = store.SaveWallet(wallet)
 		checkerr(err)
 		fmt.Println("Account saved successfully.")
@@ -1,7 +1,6 @@
 package commands
 
 import (
-	nknwallet "github.com/omani/nkn-wallet"
 	"github.com/spf13/cobra"
 )
 
@@ -23,9 +22,9 @@ func init() {
 }
 
 func runDelete() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
-	store.DeleteWalletByIndex(index)
+	checkerr(store.DeleteWalletByIndex(index))
 
 	return nil
 }
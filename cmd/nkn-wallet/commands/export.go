@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nknorg/nkn/v2/util/password"
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export accounts to other wallet formats",
+}
+var exportNKNDCmd = &cobra.Command{
+	Use:   "nknd",
+	Short: "Export an account as nknd-compatible wallet.json (and wallet.pswd)",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		cmd.MarkFlagRequired("index")
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExportNKND()
+	},
+}
+
+var (
+	exportDir        string
+	generatePassword bool
+	overwrite        bool
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportNKNDCmd)
+
+	exportNKNDCmd.Flags().StringVar(&exportDir, "out", ".", "Directory to write wallet.json (and wallet.pswd) to.")
+	exportNKNDCmd.Flags().StringVar(&walletPassword, "wallet-password", "", "Password to encrypt wallet.json with.")
+	exportNKNDCmd.Flags().BoolVar(&generatePassword, "generate-password", false, "Generate a random password and write it to wallet.pswd.")
+	exportNKNDCmd.Flags().BoolVar(&overwrite, "force", false, "Overwrite existing files.")
+
+	exportNKNDCmd.MarkFlagsMutuallyExclusive("wallet-password", "generate-password")
+}
+
+func runExportNKND() error {
+	walletPath := filepath.Join(exportDir, "wallet.json")
+	pswdPath := filepath.Join(exportDir, "wallet.pswd")
+	if !overwrite {
+		for _, p := range []string{walletPath, pswdPath} {
+			if _, err := os.Stat(p); err == nil {
+				cobra.CheckErr(fmt.Sprintf("%s already exists. Use --force to overwrite it.", p))
+			}
+		}
+	}
+
+	store, err := openStore()
+	checkerr(err)
+	wallet, err := getWallet(store, index)
+	checkerr(err)
+
+	pass := walletPassword
+	if generatePassword {
+		pass = nknwallet.GeneratePassphrase()
+	} else if len(pass) == 0 {
+		p, err := password.GetConfirmedPassword()
+		checkerr(err)
+		pass = string(p)
+	}
+
+	dat, err := wallet.ExportNKNWallet(pass)
+	checkerr(err)
+
+	checkerr(os.MkdirAll(exportDir, 0700))
+	checkerr(os.WriteFile(walletPath, dat, 0600))
+	fmt.Printf("Account %d (%s) exported to %s.\n", wallet.ID, wallet.Address(), walletPath)
+	if generatePassword {
+		checkerr(os.WriteFile(pswdPath, []byte(pass), 0600))
+		fmt.Printf("Password written to %s.\n", pswdPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nknorg/nkn/v2/util/password"
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import accounts from other wallet formats",
+}
+var importNKNWalletCmd = &cobra.Command{
+	Use:   "nkn-wallet",
+	Short: "Import accounts from nknd/nkn-sdk-go wallet.json files",
+	Long: `Import accounts from nknd/nkn-sdk-go wallet.json files.
+
+The password of a wallet file is taken from --wallet-password or
+--wallet-password-file, then from a ".pswd" file next to it (wallet.json ->
+wallet.pswd) and is prompted for otherwise. Imported accounts are encrypted
+with the age identity, recipient or passphrase chosen by the global flags.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImportNKNWallet()
+	},
+}
+
+var (
+	walletFile         string
+	walletDir          string
+	walletPassword     string
+	walletPasswordFile string
+)
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importNKNWalletCmd)
+
+	importNKNWalletCmd.Flags().StringVar(&walletFile, "file", "", "NKN wallet file to import.")
+	importNKNWalletCmd.Flags().StringVar(&walletDir, "dir", "", "Import all NKN wallet files (*.json) of a directory.")
+	importNKNWalletCmd.Flags().StringVar(&walletPassword, "wallet-password", "", "Password of the NKN wallet files.")
+	importNKNWalletCmd.Flags().StringVar(&walletPasswordFile, "wallet-password-file", "", "File containing the password of the NKN wallet files.")
+
+	importNKNWalletCmd.MarkFlagsMutuallyExclusive("file", "dir")
+	importNKNWalletCmd.MarkFlagsMutuallyExclusive("wallet-password", "wallet-password-file")
+}
+
+func runImportNKNWallet() error {
+	var files []string
+	if len(walletFile) > 0 {
+		files = append(files, walletFile)
+	} else if len(walletDir) > 0 {
+		matches, err := filepath.Glob(filepath.Join(walletDir, "*.json"))
+		checkerr(err)
+		files = append(files, matches...)
+	} else {
+		cobra.CheckErr("Use --file or --dir to choose the NKN wallet files to import.")
+	}
+	if len(files) == 0 {
+		cobra.CheckErr(fmt.Sprintf("No NKN wallet files found in %s.", walletDir))
+	}
+
+	store, err := openStore()
+	checkerr(err)
+
+	typ, key, err := accountTypeKey()
+	checkerr(err)
+	if typ == "scrypt" && len(toNamed) == 0 && len(files) > 1 {
+		// ask once for the passphrase of all imported accounts
+		key.Passphrase, err = store.PromptPassword(true)
+		checkerr(err)
+	}
+
+	var prompted string
+	failed := 0
+	for _, file := range files {
+		pass, err := nknWalletPassword(file, &prompted)
+		checkerr(err)
+
+		var wallet *nknwallet.Wallet
+		if len(toNamed) > 0 {
+			wallet, err = importNKNWalletByNamedRecipients(store, file, pass)
+		} else {
+			wallet, err = store.ImportNKNWallet(file, pass, typ, key)
+		}
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", file, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Imported %s as account %d (%s).\n", file, wallet.ID, wallet.Address())
+	}
+
+	if failed > 0 {
+		cobra.CheckErr(fmt.Sprintf("%d of %d NKN wallet files could not be imported.", failed, len(files)))
+	}
+	return nil
+}
+
+// importNKNWalletByNamedRecipients imports an NKN wallet file encrypted to the
+// names of --to-recipient.
+func importNKNWalletByNamedRecipients(store *nknwallet.Store, file, pass string) (*nknwallet.Wallet, error) {
+	account, err := nknwallet.ReadNKNWallet(file, pass)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := store.RestoreFromSeedByNamedRecipients(account.Seed(), toNamed)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.SaveWallet(wallet); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// nknWalletPassword returns the password of an NKN wallet file. A password
+// prompted for is remembered in prompted and reused for further files.
+func nknWalletPassword(file string, prompted *string) (string, error) {
+	if len(walletPassword) > 0 {
+		return walletPassword, nil
+	}
+	pswd := walletPasswordFile
+	if len(pswd) == 0 {
+		pswd = strings.TrimSuffix(file, filepath.Ext(file)) + ".pswd"
+		if _, err := os.Stat(pswd); err != nil {
+			pswd = ""
+		}
+	}
+	if len(pswd) > 0 {
+		dat, err := os.ReadFile(pswd)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(dat), "\r\n"), nil
+	}
+
+	if len(*prompted) == 0 {
+		pass, err := password.GetPassword("Enter password of NKN wallet files")
+		if err != nil {
+			return "", err
+		}
+		if len(pass) == 0 {
+			return "", errors.New("Empty NKN wallet password.")
+		}
+		*prompted = string(pass)
+	}
+	return *prompted, nil
+}
@@ -1,7 +1,6 @@
 package commands
 
 import (
-	nknwallet "github.com/omani/nkn-wallet"
 	"github.com/spf13/cobra"
 )
 
@@ -18,7 +17,7 @@ func init() {
 }
 
 func runList() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
 	checkerr(store.ListWallets())
 
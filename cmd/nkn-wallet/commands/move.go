@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/nknorg/nkn/v2/common"
-	nknwallet "github.com/omani/nkn-wallet"
 	"github.com/spf13/cobra"
 )
 
@@ -36,9 +35,9 @@ func init() {
 }
 
 func runMove() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
-	wallet, err := getWallet(store, fromID)
+	wallet, err := getSigningWallet(store, fromID)
 	checkerr(err)
 	recipientwallet, err := store.GetWalletByIndex(toID)
 	checkerr(err)
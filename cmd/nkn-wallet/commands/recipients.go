@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var namedRecipientsCmd = &cobra.Command{
+	Use:   "recipients",
+	Short: "Manage the recipient registry of the wallet",
+	Long: `Manage the recipient registry of the wallet.
+
+The registry maps names like alice or ops-group to age or SSH public keys and
+to other names. Use them with --to-recipient alice,ops-group instead of -r or
+-R when creating, restoring or rekeying accounts. Accounts encrypted to a name
+are rekeyed when its members change.
+
+Members can also be github:<user>, standing for the SSH keys of the user on
+the key server of the wallet. The keys are fetched once and pinned.`,
+}
+
+var namedRecipientsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the names of the recipient registry",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRecipientsList()
+	},
+}
+
+var namedRecipientsAddCmd = &cobra.Command{
+	Use:   "add <name> <member>...",
+	Short: "Add members to a name of the recipient registry",
+	Long: `Add members to a name of the recipient registry, creating the name if needed.
+
+A member is an age or SSH public key, a file of recipients or another name.
+Accounts encrypted to the name are offered to be rekeyed; decrypting them
+needs an identity file (-i).`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRecipientsAdd(args[0], args[1:])
+	},
+}
+
+var namedRecipientsRemoveCmd = &cobra.Command{
+	Use:   "remove <name> [<member>...]",
+	Short: "Remove members or a whole name from the recipient registry",
+	Long: `Remove members from a name of the recipient registry, or the name itself if
+no members are given.
+
+Accounts encrypted to the name are offered to be rekeyed, so removed members
+can't decrypt them anymore; decrypting them needs an identity file (-i).
+Backups of the wallet written before still hold the old encryption.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRecipientsRemove(args[0], args[1:])
+	},
+}
+
+var namedRecipientsUnpinCmd = &cobra.Command{
+	Use:   "unpin github:<user>",
+	Short: "Forget the pinned keys of a github:<user> recipient",
+	Long: `Forget the pinned keys of a github:<user> recipient, so they are fetched from
+the key server again the next time the recipient is used. Names of the
+registry and accounts encrypted to the old keys are not changed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRecipientsUnpin(args[0])
+	},
+}
+
+var rekeyAffected bool
+
+func init() {
+	rootCmd.AddCommand(namedRecipientsCmd)
+
+	namedRecipientsCmd.AddCommand(namedRecipientsListCmd)
+	namedRecipientsCmd.AddCommand(namedRecipientsAddCmd)
+	namedRecipientsCmd.AddCommand(namedRecipientsRemoveCmd)
+	namedRecipientsCmd.AddCommand(namedRecipientsUnpinCmd)
+
+	namedRecipientsCmd.PersistentFlags().BoolVarP(&rekeyAffected, "yes", "y", false, "Rekey affected accounts without asking.")
+}
+
+func runRecipientsList() error {
+	store, err := openStore()
+	checkerr(err)
+
+	registry := store.NamedRecipients()
+	pins := store.PinnedKeys()
+	if len(registry) == 0 && len(pins) == 0 {
+		fmt.Println("Recipient registry is empty.")
+		return nil
+	}
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s:\n", name)
+		for _, m := range registry[name] {
+			fmt.Printf("  %s\n", m)
+		}
+	}
+
+	names = nil
+	for name := range pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pin := pins[name]
+		fmt.Printf("%s (pinned from %s on %s):\n", name, pin.URL, pin.FetchedAt.Format(time.RFC3339))
+		for _, k := range pin.Keys {
+			fmt.Printf("  %s\n", k)
+		}
+	}
+	return nil
+}
+
+func runRecipientsUnpin(name string) error {
+	store, err := openStore()
+	checkerr(err)
+	checkerr(store.UnpinKeys(name))
+	fmt.Printf("Keys of %s will be fetched again.\n", name)
+	return nil
+}
+
+func runRecipientsAdd(name string, members []string) error {
+	store, err := openStore()
+	checkerr(err)
+
+	current := store.NamedRecipients()[name]
+	for _, m := range members {
+		add, err := memberNames(store, m)
+		checkerr(err)
+		for _, a := range add {
+			if indexOf(current, a) < 0 {
+				current = append(current, a)
+			}
+		}
+	}
+	checkerr(store.SetNamedRecipient(name, current))
+	fmt.Printf("%s: %s\n", name, strings.Join(current, ", "))
+
+	return rekeyNamedRecipient(store, name)
+}
+
+func runRecipientsRemove(name string, members []string) error {
+	store, err := openStore()
+	checkerr(err)
+
+	if len(members) == 0 {
+		checkerr(store.RemoveNamedRecipient(name))
+		fmt.Printf("Removed %s.\n", name)
+		return nil
+	}
+
+	current, ok := store.NamedRecipients()[name]
+	if !ok {
+		cobra.CheckErr(fmt.Sprintf("Unknown recipient name %s.", name))
+	}
+	for _, m := range members {
+		remove, err := memberNames(store, m)
+		checkerr(err)
+		for _, r := range remove {
+			i := indexOf(current, r)
+			if i < 0 {
+				cobra.CheckErr(fmt.Sprintf("%s is not a member of %s.", r, name))
+			}
+			current = append(current[:i:i], current[i+1:]...)
+		}
+	}
+	if len(current) == 0 {
+		cobra.CheckErr(fmt.Sprintf("Can't remove all members of %s. Remove the name instead.", name))
+	}
+	checkerr(store.SetNamedRecipient(name, current))
+	fmt.Printf("%s: %s\n", name, strings.Join(current, ", "))
+
+	return rekeyNamedRecipient(store, name)
+}
+
+// memberNames returns the registry entries for a member given on the command
+// line: a name of the registry or the recipients of a key or file.
+func memberNames(store *nknwallet.Store, m string) ([]string, error) {
+	if _, ok := store.NamedRecipients()[m]; ok {
+		return []string{m}, nil
+	}
+	return recipientNames(store, m)
+}
+
+// rekeyNamedRecipient offers to rekey the accounts encrypted to name after its
+// members changed.
+func rekeyNamedRecipient(store *nknwallet.Store, name string) error {
+	affected := store.AccountsByNamedRecipient(name)
+	if len(affected) == 0 {
+		return nil
+	}
+
+	fmt.Printf("%d accounts are encrypted to %s:\n", len(affected), name)
+	for _, w := range affected {
+		fmt.Printf("  %d %s (%s)\n", w.ID, w.Address(), strings.Join(w.NamedRecipients, ", "))
+	}
+	if len(ageIdentity) == 0 {
+		fmt.Println("Rekey them with an identity file (-i) that decrypts them:")
+		for _, w := range affected {
+			fmt.Printf("  nkn-wallet change recipients --index %d -i <identity> --to-recipient %s\n", w.ID, strings.Join(w.NamedRecipients, ","))
+		}
+		return nil
+	}
+	if !rekeyAffected && !confirm("Rekey them now?") {
+		return nil
+	}
+
+	failed := 0
+	for _, w := range affected {
+		wallet, err := store.NewWalletByIdentity(ageIdentity, w.ID, nil)
+		if err == nil {
+			err = store.RekeyToNamedRecipients(wallet, wallet.NamedRecipients)
+		}
+		if err != nil {
+			fmt.Printf("Account %d: %v\n", w.ID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Account %d rekeyed.\n", w.ID)
+	}
+	if failed > 0 {
+		cobra.CheckErr(fmt.Sprintf("%d accounts could not be rekeyed.", failed))
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on stdin. It reads only the answer, leaving
+// the rest of stdin to passphrase prompts.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	var answer []byte
+	b := make([]byte, 1)
+	for {
+		if n, err := os.Stdin.Read(b); n == 0 || err != nil || b[0] == '\n' {
+			break
+		}
+		answer = append(answer, b[0])
+	}
+	a := strings.ToLower(strings.TrimSpace(string(answer)))
+	return a == "y" || a == "yes"
+}
@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var rehardenCmd = &cobra.Command{
+	Use:   "reharden",
+	Short: "Re-encrypt passphrase encrypted accounts with a higher scrypt work factor",
+	Long: `Re-encrypt passphrase encrypted accounts with a higher scrypt work factor.
+
+Every SCRYPT and TWOFACTOR account (or only the one given with --index) whose
+passphrase is derived with a lower work factor than --scrypt-work-factor, or
+the default of the wallet, is decrypted with its passphrase and encrypted
+again with the same passphrase and the higher work factor. The passphrase of
+every account is prompted for. Two-factor accounts also need their identity
+file (-i).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runReharden()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rehardenCmd)
+}
+
+func runReharden() error {
+	store, err := openStore()
+	checkerr(err)
+
+	target := store.ScryptWorkFactor()
+	var wallets []*nknwallet.Wallet
+	if index > 0 {
+		w, err := store.GetWalletByIndex(index)
+		checkerr(err)
+		wallets = append(wallets, w)
+	} else {
+		wallets = store.GetWallets()
+	}
+
+	rehardened, failed := 0, 0
+	for _, w := range wallets {
+		typ := strings.ToLower(w.Type)
+		if typ != "scrypt" && typ != "twofactor" {
+			if index > 0 {
+				cobra.CheckErr("Account is not encrypted with a passphrase.")
+			}
+			continue
+		}
+		if current := w.ScryptWorkFactor(); current >= target {
+			fmt.Printf("Account %d: work factor %d already.\n", w.ID, current)
+			continue
+		}
+		if typ == "twofactor" && len(ageIdentity) == 0 {
+			fmt.Printf("Account %d: two-factor account skipped, use its identity file (-i).\n", w.ID)
+			failed++
+			continue
+		}
+
+		pass, err := store.PassphraseProvider().Passphrase(nknwallet.PassphraseRequest{Prompt: fmt.Sprintf("Enter passphrase of account %d", w.ID)})
+		if err == nil {
+			err = store.Reharden(w, ageIdentity, pass, target)
+		}
+		if err != nil {
+			fmt.Printf("Account %d: %v\n", w.ID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Account %d: work factor %d.\n", w.ID, target)
+		rehardened++
+	}
+
+	fmt.Printf("%d accounts re-encrypted with scrypt work factor %d.\n", rehardened, target)
+	if failed > 0 {
+		cobra.CheckErr(fmt.Sprintf("%d accounts could not be re-encrypted.", failed))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var rekeyAllCmd = &cobra.Command{
+	Use:   "rekey-all",
+	Short: "Re-encrypt all accounts of an old identity to new recipients",
+	Long: `Re-encrypt all accounts of an old identity to new recipients, e.g. after the
+identity file leaked.
+
+Every account the old identity decrypts is encrypted to the recipients given
+with --to, to names of the recipient registry given with --to-recipient or
+with a passphrase (--to-password), and the wallet is saved once all accounts
+are done. Re-encrypted accounts are recorded in a journal file
+as they are done, so an interrupted run continues where it stopped when it
+is started again. A JSON report lists the accounts that were migrated,
+skipped and failed to decrypt.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRekeyAll()
+	},
+}
+
+var (
+	oldIdentity  string
+	toRecipients []string
+	rekeyJournal string
+	rekeyReport  string
+)
+
+func init() {
+	rootCmd.AddCommand(rekeyAllCmd)
+
+	rekeyAllCmd.Flags().StringVar(&oldIdentity, "old-identity", "", "Identity file the accounts are encrypted to now.")
+	rekeyAllCmd.Flags().StringArrayVar(&toRecipients, "to", nil, "New recipient or recipient file. May be repeated.")
+	rekeyAllCmd.Flags().BoolVar(&toPassword, "to-password", false, "Encrypt the accounts with a passphrase instead.")
+	rekeyAllCmd.Flags().StringVar(&rekeyJournal, "journal", "", "Journal file to resume an interrupted run from (default: wallet path + \".rekey\").")
+	rekeyAllCmd.Flags().StringVar(&rekeyReport, "report", "", "Write the JSON report to this file instead of stdout.")
+
+	rekeyAllCmd.MarkFlagRequired("old-identity")
+	rekeyAllCmd.MarkFlagsMutuallyExclusive("to", "to-password")
+}
+
+func runRekeyAll() error {
+	if len(toRecipients) == 0 && len(toNamed) == 0 && !toPassword {
+		cobra.CheckErr("Use --to, --to-recipient or --to-password to choose the new recipients.")
+	}
+	if len(toNamed) > 0 && (len(toRecipients) > 0 || toPassword) {
+		cobra.CheckErr("--to-recipient can't be combined with --to or --to-password.")
+	}
+
+	store, err := openStore()
+	checkerr(err)
+
+	var recipients []age.Recipient
+	if toPassword {
+		pass, err := store.PromptChangedPassword()
+		checkerr(err)
+		r, err := store.ScryptRecipient(pass)
+		checkerr(err)
+		recipients = append(recipients, r)
+	}
+	for _, r := range toRecipients {
+		recs, err := parseRecipientArg(store, r)
+		checkerr(err)
+		recipients = append(recipients, recs...)
+	}
+
+	if len(toNamed) > 0 {
+		recipients, err = store.ResolveRecipients(toNamed)
+		checkerr(err)
+	}
+
+	journal := rekeyJournal
+	if len(journal) == 0 {
+		journal = localPath(path) + ".rekey"
+	}
+
+	report, err := store.RekeyAll(oldIdentity, recipients, &nknwallet.RekeyAllOptions{
+		Journal:         journal,
+		NamedRecipients: toNamed,
+		Progress: func(done, total int, res nknwallet.RekeyResult) {
+			status := res.Status
+			if res.Resumed {
+				status += " (from journal)"
+			}
+			if len(res.Reason) > 0 {
+				status += ": " + res.Reason
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] account %d %s %s\n", done, total, res.ID, res.Address, status)
+		},
+	})
+	if report != nil {
+		dat, err := json.MarshalIndent(report, "", "  ")
+		checkerr(err)
+		if len(rekeyReport) > 0 {
+			checkerr(os.WriteFile(rekeyReport, append(dat, '\n'), 0600))
+		} else {
+			fmt.Println(string(dat))
+		}
+	}
+	if err != nil {
+		cobra.CheckErr(fmt.Sprintf("%v\nNo account was changed. Run rekey-all again to resume from %s.", err, journal))
+	}
+
+	fmt.Fprintf(os.Stderr, "%d accounts re-encrypted, %d skipped, %d failed.\n",
+		report.Count(nknwallet.RekeyStatusRekeyed), report.Count(nknwallet.RekeyStatusSkipped), report.Count(nknwallet.RekeyStatusFailed))
+	return nil
+}
+
+// localPath returns the file system path of a wallet location, stripping the
+// scheme of URLs like dir:///path.
+func localPath(location string) string {
+	if i := strings.Index(location, "://"); i >= 0 {
+		return location[i+3:]
+	}
+	return location
+}
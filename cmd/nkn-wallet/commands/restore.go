@@ -1,7 +1,16 @@
 package commands
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
 
 	"github.com/nknorg/nkn/v2/util/password"
 	nknwallet "github.com/omani/nkn-wallet"
@@ -17,41 +26,313 @@ var restoreCmd = &cobra.Command{
 }
 
 var (
-	seed string
+	seed        string
+	mnemonic    string
+	master      string
+	gapLimit    int
+	deriveCount int
+	shares      []string
+	shareIDs    []string
 )
 
 func init() {
 	rootCmd.AddCommand(restoreCmd)
 
 	restoreCmd.Flags().StringVar(&seed, "seed", "", "Seed of the account to be restored.")
+	restoreCmd.Flags().StringVar(&mnemonic, "mnemonic", "", "BIP39 mnemonic of the account to be restored. Words may be abbreviated to unique prefixes (e.g. their first 4 letters). Use '-' to be prompted for it.")
+
+	restoreCmd.Flags().StringVar(&master, "master", "", "Master secret (hex or BIP39 mnemonic) to restore all derived accounts from. Use '-' to be prompted for it.")
+	restoreCmd.Flags().IntVar(&gapLimit, "gap-limit", nknwallet.DefaultGapLimit, "With --master, stop looking for used accounts after this many consecutive unused ones.")
+	restoreCmd.Flags().IntVar(&deriveCount, "count", 0, "With --master, restore the first n derived accounts without looking up which ones are used.")
+	restoreCmd.Flags().StringVar(&derivePath, "derivation-path", nknwallet.DefaultDerivationPath, "With --master, path below which accounts are derived.")
+
+	restoreCmd.Flags().StringArrayVar(&shares, "share", nil, "Share created by split: the words, a share file or '-' to be prompted for it. Repeat for every share.")
+	restoreCmd.Flags().StringArrayVar(&shareIDs, "share-identity", nil, "Identity file to decrypt encrypted shares with. May be repeated.")
+
+	restoreCmd.MarkFlagsMutuallyExclusive("seed", "mnemonic", "master", "share")
 }
 
 func runRestore() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
 
-	if len(seed) == 0 {
-		s, err := password.GetPassword("Seed")
+	if len(master) > 0 {
+		return runRestoreMaster(store)
+	}
+
+	var seedbyte []byte
+	if len(shares) > 0 {
+		seedbyte, err = combineShares()
+		checkerr(err)
+	} else if len(mnemonic) > 0 {
+		if mnemonic == "-" {
+			m, err := password.GetPassword("Mnemonic")
+			checkerr(err)
+			mnemonic = string(m)
+		}
+		seedbyte, err = nknwallet.MnemonicToSeed(mnemonic)
 		checkerr(err)
-		seed = string(s)
+	} else {
+		if len(seed) == 0 {
+			s, err := password.GetPassword("Seed")
+			checkerr(err)
+			seed = string(s)
 
+		}
+		seedbyte, err = hex.DecodeString(seed)
+		checkerr(err)
 	}
-	seedbyte, err := hex.DecodeString(seed)
+
+	wallet, err := restoreWallet(store, seedbyte)
 	checkerr(err)
+	checkerr(store.SaveWallet(wallet))
 
-	var wallet *nknwallet.Wallet
+	return nil
+}
 
-	if len(ageIdentity) > 0 {
-		wallet, err = store.RestoreFromSeedByIdentity(seedbyte, ageIdentity)
+// restoreWallet encrypts seed with the key chosen by the age flags.
+func restoreWallet(store *nknwallet.Store, seed []byte) (*nknwallet.Wallet, error) {
+	if twoFactor && len(ageIdentity) == 0 {
+		return nil, errTwoFactorIdentity
+	}
+	if len(toNamed) > 0 {
+		return store.RestoreFromSeedByNamedRecipients(seed, toNamed)
+	} else if twoFactor {
+		return store.RestoreFromSeedByIdentityAndPassword(seed, ageIdentity)
+	} else if len(ageIdentity) > 0 {
+		return store.RestoreFromSeedByIdentity(seed, ageIdentity)
+	} else if len(ageRecipientFile) > 0 {
+		return store.RestoreFromSeedByRecipientFile(seed, ageRecipientFile)
+	} else if len(ageRecipient) > 0 {
+		return store.RestoreFromSeedByRecipient(seed, ageRecipient)
+	}
+	return store.RestoreFromSeedByPassword(seed)
+}
+
+// accountTypeKey returns the account type and key new accounts are encrypted
+// with, chosen by the same flags as restoreWallet. Named recipients are not
+// an account type; check --to-recipient first.
+func accountTypeKey() (string, nknwallet.AccountKey, error) {
+	if twoFactor && len(ageIdentity) == 0 {
+		return "", nknwallet.AccountKey{}, errTwoFactorIdentity
+	}
+	if twoFactor {
+		return "twofactor", nknwallet.AccountKey{Identity: ageIdentity}, nil
+	} else if len(ageIdentity) > 0 {
+		return "identity", nknwallet.AccountKey{Identity: ageIdentity}, nil
 	} else if len(ageRecipientFile) > 0 {
-		wallet, err = store.RestoreFromSeedByIdentity(seedbyte, ageIdentity)
+		return "recipient-file", nknwallet.AccountKey{RecipientFile: ageRecipientFile}, nil
 	} else if len(ageRecipient) > 0 {
-		wallet, err = store.RestoreFromSeedByIdentity(seedbyte, ageIdentity)
+		return "recipient", nknwallet.AccountKey{Recipient: ageRecipient}, nil
+	}
+	return "scrypt", nknwallet.AccountKey{}, nil
+}
+
+// combineShares rebuilds a seed from the shares given with --share.
+func combineShares() ([]byte, error) {
+	var parsed []*nknwallet.Share
+	for i, s := range shares {
+		if s == "-" {
+			p, err := password.GetPassword(fmt.Sprintf("Share %d", i+1))
+			if err != nil {
+				return nil, err
+			}
+			s = string(p)
+		} else if dat, err := os.ReadFile(s); err == nil {
+			s = string(dat)
+		}
+
+		var sh *nknwallet.Share
+		var err error
+		if strings.HasPrefix(strings.TrimSpace(s), armor.Header) {
+			sh, err = nknwallet.DecryptShareByIdentity(s, passphraseProvider(), shareIDs...)
+		} else {
+			sh, err = nknwallet.ParseShare(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("share %d: %v", i+1, err)
+		}
+		parsed = append(parsed, sh)
+	}
+	return nknwallet.CombineShares(parsed)
+}
+
+// seedEncrypter returns the recipients chosen by the age flags and a function
+// encrypting seeds to them. In password and two-factor mode the passphrase is
+// prompted for once and used for all seeds.
+func seedEncrypter(store *nknwallet.Store) ([]age.Recipient, func(seed []byte) (*nknwallet.Wallet, error), error) {
+	if len(toNamed) > 0 {
+		recipients, err := store.ResolveRecipients(toNamed)
+		if err != nil {
+			return nil, nil, err
+		}
+		return recipients, func(seed []byte) (*nknwallet.Wallet, error) {
+			return store.RestoreFromSeedByNamedRecipients(seed, toNamed)
+		}, nil
+	}
+	if len(ageIdentity) > 0 || len(ageRecipientFile) > 0 || len(ageRecipient) > 0 {
+		var recipients []age.Recipient
+		var err error
+		if len(ageIdentity) > 0 {
+			recipients, err = store.ParseIdentity(ageIdentity)
+		} else if len(ageRecipientFile) > 0 {
+			recipients, err = store.ParseRecipientFile(ageRecipientFile)
+		} else {
+			recipients, err = store.ParseRecipient(ageRecipient)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if twoFactor && len(ageIdentity) > 0 {
+			pass, err := store.PromptPassword(true)
+			if err != nil {
+				return nil, nil, err
+			}
+			return recipients, func(seed []byte) (*nknwallet.Wallet, error) {
+				return store.RestoreFromSeedByRecipientsAndPassphrase(seed, recipients, pass)
+			}, nil
+		}
+		return recipients, func(seed []byte) (*nknwallet.Wallet, error) {
+			return restoreWallet(store, seed)
+		}, nil
+	}
+	if twoFactor {
+		return nil, nil, errTwoFactorIdentity
+	}
+
+	pass, err := store.PromptPassword(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := store.ScryptRecipient(pass)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []age.Recipient{r}, func(seed []byte) (*nknwallet.Wallet, error) {
+		return store.RestoreFromSeedByPassphrase(seed, pass)
+	}, nil
+}
+
+// masterSecret decrypts the master secret of the store with the identity file
+// or passphrase.
+func masterSecret(store *nknwallet.Store) ([]byte, error) {
+	if len(ageIdentity) > 0 {
+		return store.MasterSecretByIdentity(ageIdentity)
+	} else if len(ageRecipientFile) > 0 || len(ageRecipient) > 0 {
+		return nil, errors.New("Use an identity file or a password to decrypt the master secret.")
+	}
+	return store.MasterSecretByPassword()
+}
+
+// deriveWallet derives the next account from the master secret of the store.
+// A store without master secret gets a new one, which is only stored by the
+// returned save function together with the account.
+func deriveWallet(store *nknwallet.Store) (*nknwallet.Wallet, func() error, error) {
+	var m []byte
+	var err error
+	if store.HasMasterSecret() {
+		if m, err = masterSecret(store); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	recipients, encrypt, err := seedEncrypter(store)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var seed []byte
+	var path string
+	saveMaster := func() error { return nil }
+	if m == nil {
+		if m, err = nknwallet.NewMasterSecret(); err != nil {
+			return nil, nil, err
+		}
+		seed, path, err = nknwallet.DeriveSeedBelow(m, derivePath, 0)
+		saveMaster = func() error {
+			if err := store.SetMasterSecret(m, derivePath, recipients); err != nil {
+				return err
+			}
+			mnemonic, err := nknwallet.SeedToMnemonic(m)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Created master secret. Keep its mnemonic safe, it restores all derived accounts:")
+			fmt.Printf("Master mnemonic: %s\n", mnemonic)
+			return nil
+		}
 	} else {
-		wallet, err = store.RestoreFromSeedByPassword(seedbyte)
+		seed, path, err = store.DeriveSeedByIndex(m, store.NextDerivationIndex())
 	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w, err := encrypt(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.Path = path
+	return w, saveMaster, nil
+}
+
+func runRestoreMaster(store *nknwallet.Store) error {
+	if master == "-" {
+		m, err := password.GetPassword("Master secret")
+		checkerr(err)
+		master = string(m)
+	}
+	var m []byte
+	var err error
+	if len(strings.Fields(master)) > 1 {
+		m, err = nknwallet.MnemonicToSeed(master)
+	} else {
+		m, err = hex.DecodeString(master)
+	}
+	checkerr(err)
+
+	recipients, encrypt, err := seedEncrypter(store)
 	checkerr(err)
-	store.SaveWallet(wallet)
+
+	if store.HasMasterSecret() {
+		existing, err := masterSecret(store)
+		checkerr(err)
+		if !bytes.Equal(existing, m) {
+			cobra.CheckErr("Wallet already has a different master secret.")
+		}
+	} else {
+		checkerr(store.SetMasterSecret(m, derivePath, recipients))
+	}
+
+	var indices []int
+	if deriveCount > 0 {
+		for i := 0; i < deriveCount; i++ {
+			indices = append(indices, i)
+		}
+	} else {
+		fmt.Printf("Looking for used accounts (gap limit %d)...\n", gapLimit)
+		indices, err = store.ScanDerived(m, gapLimit, func(i int, address string) (bool, error) {
+			return nknwallet.IsAddressUsed(context.Background(), address, nil)
+		})
+		checkerr(err)
+		if len(indices) == 0 {
+			fmt.Println("No used accounts found. Use --count to restore accounts regardless.")
+		}
+	}
+
+	for _, i := range indices {
+		seed, path, err := store.DeriveSeedByIndex(m, i)
+		checkerr(err)
+		w, err := encrypt(seed)
+		checkerr(err)
+		w.Path = path
+
+		if err := store.SaveWallet(w); err != nil {
+			fmt.Printf("%s %s: %v\n", path, w.Address(), err)
+			continue
+		}
+		fmt.Printf("%s %s: restored as account %d\n", path, w.Address(), w.ID)
+	}
 
 	return nil
 }
@@ -2,9 +2,13 @@ package commands
 
 import (
 	"errors"
+	"fmt"
 	"math/rand"
+	"os"
+	"strings"
 	"time"
 
+	"filippo.io/age"
 	nknwallet "github.com/omani/nkn-wallet"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +21,23 @@ var (
 	ageRecipient     string
 	ageRecipientFile string
 	ageIdentity      string
+	metadataIdentity string
+	backups          int
+	lockTimeout      time.Duration
+	twoFactor        bool
+	toNamed          []string
+	scryptWorkFactor int
+	keyServer        string
+
+	passphraseEnv     string
+	passphraseFile    string
+	passphraseFD      int
+	passphraseCommand string
+
+	newPassphraseEnv     string
+	newPassphraseFile    string
+	newPassphraseFD      int
+	newPassphraseCommand string
 )
 
 var rootCmd = &cobra.Command{
@@ -29,9 +50,9 @@ nkn-wallet is a library that implements nkn-sdk-go with a new wallet
 functionality utilizing age encryption and using the NKN OpenAPI for
 querying the NKN blockchain.
 
-Upcoming releases will include the possibility for encryption by
-SSH public key ("ssh-ed25519 AAAA...", "ssh-rsa AAAA...") stored on disk
-or by fetching the keys from a Github user profile (github.com/[user].keys).
+Accounts can be encrypted to age and SSH public keys ("ssh-ed25519 AAAA...",
+"ssh-rsa AAAA...") stored on disk, or to the keys of a Github user profile
+(github:[user], fetched from github.com/[user].keys and pinned in the wallet).
 
 URL: https://github.com/omani/nkn-wallet
 MIT license. Copyright (c) 2023 HAH! Sun
@@ -54,22 +75,127 @@ func init() {
 
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 
-	rootCmd.PersistentFlags().StringVarP(&path, "path", "p", "./nkn-wallet.json", "path to wallet file")
+	rootCmd.PersistentFlags().StringVarP(&path, "path", "p", "./nkn-wallet.json", "path to wallet file, or wallet location URL [file://, dir://, mem://]")
 	rootCmd.PersistentFlags().StringVar(&ip, "ip", "mainnet-seed-0001.org", "DNS/IP of NKN remote node")
-	rootCmd.PersistentFlags().StringVarP(&ageRecipient, "age-recipient", "r", "", "Use recipient for age encryption ['ssh-', 'age1'].")
+	rootCmd.PersistentFlags().StringVarP(&ageRecipient, "age-recipient", "r", "", "Use recipient for age encryption ['ssh-', 'age1', 'age1<plugin>1', 'github:<user>'].")
 	rootCmd.PersistentFlags().StringVarP(&ageRecipientFile, "age-recipient-file", "R", "", "Use recipient file for age encryption [ssh public-key, age recipient].")
 	rootCmd.PersistentFlags().StringVarP(&ageIdentity, "age-identity", "i", "", "Use identity file for age decryption [ssh private key, age identity file].")
 
+	rootCmd.PersistentFlags().StringVar(&metadataIdentity, "metadata-identity", "", "Use identity file to decrypt the wallet metadata (default the identity file of -i).")
+
 	rootCmd.PersistentFlags().IntVar(&index, "index", 0, "Use account with index.")
+	rootCmd.PersistentFlags().IntVar(&backups, "backups", nknwallet.DefaultBackups, "Number of backup generations of the wallet file to keep.")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", nknwallet.DefaultLockTimeout, "Time to wait for the wallet file lock held by another process (0 waits indefinitely).")
+
+	rootCmd.PersistentFlags().BoolVar(&twoFactor, "two-factor", false, "Encrypt new accounts with a passphrase and to the identity file (-i): both are needed to decrypt them.")
+
+	rootCmd.PersistentFlags().IntVar(&scryptWorkFactor, "scrypt-work-factor", 0, "Scrypt work factor (log2 of N) for new passphrases (0 uses the default of the wallet).")
+	rootCmd.PersistentFlags().StringVar(&keyServer, "key-server", "", "Fetch the keys of github:<user> recipients from <url>/<user>.keys, e.g. https://gitlab.com (default the key server of the wallet).")
+	rootCmd.PersistentFlags().StringSliceVar(&toNamed, "to-recipient", nil, "Encrypt to names of the recipient registry, e.g. alice,ops-group.")
 
+	rootCmd.PersistentFlags().StringVar(&passphraseEnv, "passphrase-env", "", "Read passphrases from this environment variable instead of the terminal.")
+	rootCmd.PersistentFlags().StringVar(&passphraseFile, "passphrase-file", "", "Read passphrases from the first line of this file instead of the terminal.")
+	rootCmd.PersistentFlags().IntVar(&passphraseFD, "passphrase-fd", -1, "Read the passphrase from the first line of this inherited file descriptor instead of the terminal.")
+	rootCmd.PersistentFlags().StringVar(&passphraseCommand, "passphrase-command", "", "Run this shell command (e.g. \"pass show nkn-wallet\") and use the first line of its output as passphrase.")
+
+	rootCmd.PersistentFlags().StringVar(&newPassphraseEnv, "new-passphrase-env", "", "Read new passphrases from this environment variable, e.g. to change a passphrase given with --passphrase-env.")
+	rootCmd.PersistentFlags().StringVar(&newPassphraseFile, "new-passphrase-file", "", "Read new passphrases from the first line of this file.")
+	rootCmd.PersistentFlags().IntVar(&newPassphraseFD, "new-passphrase-fd", -1, "Read the new passphrase from the first line of this inherited file descriptor.")
+	rootCmd.PersistentFlags().StringVar(&newPassphraseCommand, "new-passphrase-command", "", "Run this shell command and use the first line of its output as new passphrase.")
+
+	rootCmd.MarkFlagsMutuallyExclusive("passphrase-env", "passphrase-file", "passphrase-fd", "passphrase-command")
+	rootCmd.MarkFlagsMutuallyExclusive("new-passphrase-env", "new-passphrase-file", "new-passphrase-fd", "new-passphrase-command")
 	rootCmd.MarkFlagsMutuallyExclusive("age-recipient", "age-recipient-file", "age-identity")
+	rootCmd.MarkFlagsMutuallyExclusive("age-recipient", "age-recipient-file", "to-recipient")
+}
+
+var errTwoFactorIdentity = errors.New("Use --two-factor together with an identity file (-i).")
+
+func openStore() (*nknwallet.Store, error) {
+	return nknwallet.NewStore(path,
+		nknwallet.WithPassphraseProvider(passphraseProvider()),
+		nknwallet.WithBackups(backups),
+		nknwallet.WithLockTimeout(lockTimeout),
+		nknwallet.WithMetadataKey(metadataKey()),
+		nknwallet.WithScryptWorkFactor(scryptWorkFactor),
+		nknwallet.WithKeyServer(strings.TrimSuffix(keyServer, "/")),
+	)
+}
+
+// metadataKey returns the key for encrypted wallet metadata: the identity file
+// of --metadata-identity, or else the key chosen by the same flags as the key
+// of an account. Its recipients are only used by change metadata-encryption;
+// the store reseals to the recipients recorded then and opens metadata sealed
+// with a passphrase with the passphrase provider.
+func metadataKey() *nknwallet.MetadataKey {
+	if len(metadataIdentity) > 0 {
+		return nknwallet.MetadataKeyByIdentity(metadataIdentity, passphraseProvider())
+	} else if len(ageIdentity) > 0 {
+		return nknwallet.MetadataKeyByIdentity(ageIdentity, passphraseProvider())
+	} else if len(ageRecipientFile) > 0 {
+		return nknwallet.MetadataKeyByRecipientFile(ageRecipientFile)
+	} else if len(ageRecipient) > 0 {
+		return nknwallet.MetadataKeyByRecipient(ageRecipient)
+	}
+	return nknwallet.MetadataKeyByPassword(passphraseProvider())
+}
+
+var provider nknwallet.PassphraseProvider
+
+// passphraseProvider returns the source of passphrases chosen by the
+// passphrase flags, the terminal by default. New passphrases come from the
+// new passphrase flags if given. A single non-interactive source gives the
+// same passphrase to every request, so it can't give a new passphrase once it
+// gave one to decrypt with, e.g. to change a passphrase; nor can an identity
+// file, an account and the wallet metadata have different passphrases then,
+// unless --passphrase-command tells them apart by their prompt.
+func passphraseProvider() nknwallet.PassphraseProvider {
+	if provider != nil {
+		return provider
+	}
+	current := passphraseSource(passphraseEnv, passphraseFile, passphraseFD, passphraseCommand)
+	newSource := passphraseSource(newPassphraseEnv, newPassphraseFile, newPassphraseFD, newPassphraseCommand)
+	if current == nil {
+		current = nknwallet.TTYPassphraseProvider{}
+		if newSource == nil {
+			provider = current
+			return provider
+		}
+	}
+	provider = &nknwallet.SplitPassphraseProvider{Current: current, New: newSource}
+	return provider
+}
+
+// passphraseSource returns the non-interactive passphrase provider chosen by
+// one of the flags, or nil.
+func passphraseSource(env, file string, fd int, command string) nknwallet.PassphraseProvider {
+	if len(env) > 0 {
+		return nknwallet.EnvPassphraseProvider{Name: env}
+	} else if len(file) > 0 {
+		return nknwallet.FilePassphraseProvider{Path: file}
+	} else if fd >= 0 {
+		return nknwallet.NewFDPassphraseProvider(fd)
+	} else if len(command) > 0 {
+		return nknwallet.CommandPassphraseProvider{Command: []string{"sh", "-c", command}}
+	}
+	return nil
 }
 
 func getWallet(store *nknwallet.Store, index int) (*nknwallet.Wallet, error) {
 	var wallet *nknwallet.Wallet
 	var err error
 
-	if len(ageIdentity) > 0 {
+	if twoFactor && len(ageIdentity) == 0 {
+		return nil, errTwoFactorIdentity
+	}
+	if len(toNamed) > 0 && index == 0 {
+		if twoFactor {
+			return nil, errors.New("Two-factor accounts can't be created for named recipients.")
+		}
+		wallet, err = store.NewWalletByNamedRecipients(toNamed, index, nil)
+	} else if twoFactor {
+		wallet, err = store.NewWalletByIdentityAndPassword(ageIdentity, index, nil)
+	} else if len(ageIdentity) > 0 {
 		wallet, err = store.NewWalletByIdentity(ageIdentity, index, nil)
 	} else if len(ageRecipientFile) > 0 {
 		wallet, err = store.NewWalletByRecipientFile(ageRecipientFile, index, nil)
@@ -86,3 +212,48 @@ func getWallet(store *nknwallet.Store, index int) (*nknwallet.Wallet, error) {
 	}
 	return nil, errors.New("Error: No wallet could be fetched.")
 }
+
+// getSigningWallet returns the account with index signing through its external
+// signer, or through the agent of NKN_WALLET_AGENT_SOCK if it holds the
+// account, and decrypts it otherwise. Use it for commands that don't need the
+// seed.
+func getSigningWallet(store *nknwallet.Store, index int) (*nknwallet.Wallet, error) {
+	if w, err := store.GetWalletByIndex(index); err == nil && w.IsExternal() {
+		return store.NewExternalWallet(index, nil)
+	}
+	if agent := nknwallet.AgentClientFromEnv(); agent != nil && store.IsExistWalletByIndex(index) {
+		wallet, err := store.NewWalletByAgent(agent, index, nil)
+		if err == nil {
+			return wallet, nil
+		}
+		if !errors.Is(err, nknwallet.ErrAgentKeyNotFound) {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	return getWallet(store, index)
+}
+
+// getQueryWallet returns the account with index for commands that only query
+// the blockchain: watch-only accounts as they are, external accounts by their
+// recorded address and public key without running their signer, other
+// accounts like getSigningWallet.
+func getQueryWallet(store *nknwallet.Store, index int) (*nknwallet.Wallet, error) {
+	if w, err := store.GetWalletByIndex(index); err == nil {
+		switch {
+		case w.IsWatchOnly():
+			return store.NewWatchWallet(index, nil)
+		case w.IsExternal():
+			return store.NewQueryWallet(index, nil)
+		}
+	}
+	return getSigningWallet(store, index)
+}
+
+// parseRecipientArg parses a recipient given on the command line, which may
+// also be a file of recipients.
+func parseRecipientArg(store *nknwallet.Store, r string) ([]age.Recipient, error) {
+	if _, err := os.Stat(r); err == nil {
+		return store.ParseRecipientFile(r)
+	}
+	return store.ParseRecipient(r)
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/jedib0t/go-pretty/table"
 	"github.com/jedib0t/go-pretty/text"
-	nknwallet "github.com/omani/nkn-wallet"
 	"github.com/spf13/cobra"
 )
 
@@ -53,12 +52,14 @@ func init() {
 	showCmd.AddCommand(balanceCmd)
 	showCmd.AddCommand(infoCmd)
 	showCmd.AddCommand(txnCmd)
+
+	infoCmd.Flags().BoolVar(&showMnemonic, "mnemonic", false, "Also print the seed as 24-word BIP39 mnemonic.")
 }
 
 func runShowBalance() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
-	wallet, err := getWallet(store, index)
+	wallet, err := getQueryWallet(store, index)
 	checkerr(err)
 	balance, err := wallet.OpenAPI().GetBalance()
 	checkerr(err)
@@ -75,7 +76,7 @@ func runShowBalance() error {
 }
 
 func runShowInfo() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
 	wallet, err := getWallet(store, index)
 	checkerr(err)
@@ -91,13 +92,19 @@ func runShowInfo() error {
 	t.AppendRow(table.Row{wallet.ID, wallet.Alias, wallet.Address(), pubkey, wallet.ShowSeed()})
 	t.Render()
 
+	if showMnemonic {
+		mnemonic, err := wallet.Mnemonic()
+		checkerr(err)
+		fmt.Printf("Mnemonic: %s\n", mnemonic)
+	}
+
 	return nil
 }
 
 func runShowTxn() error {
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
-	wallet, err := getWallet(store, index)
+	wallet, err := getQueryWallet(store, index)
 	checkerr(err)
 	txn, err := wallet.OpenAPI().GetTransactions()
 	checkerr(err)
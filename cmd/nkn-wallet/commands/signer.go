@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var addSignerCmd = &cobra.Command{
+	Use:   "add-signer [flags] -- <command> [<arg>...]",
+	Short: "Add an account whose key is kept by an external signer",
+	Long: `Add an account whose key is kept by an external signer, e.g. an HSM
+bridge, a separate privileged process or a proxy to another machine.
+
+The signer command is recorded in the wallet and run whenever the account
+signs. It reads one JSON request line on stdin and answers with one JSON line
+on stdout:
+
+  {"version":1,"op":"pubkey","address":"NKN..."}  ->  {"pubkey":"<hex>"}
+  {"version":1,"op":"sign","address":"NKN...","tx":"<hex>"}  ->  {"signature":"<hex>"}
+
+tx is the protobuf encoded unsigned transaction. Errors are answered with
+{"error":"..."}. Without --address the default account of the signer is added.
+Transfer, move and tx sign use the signer; show balance/transactions query by
+the recorded address without running it. Commands needing the seed are
+refused.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAddSigner(args)
+	},
+}
+
+var signerAddress string
+
+func init() {
+	rootCmd.AddCommand(addSignerCmd)
+
+	addSignerCmd.Flags().StringVar(&signerAddress, "address", "", "Address of the account of the signer (default the account the signer answers with).")
+	addSignerCmd.Flags().StringVar(&alias, "alias", "", "Alias of the account.")
+}
+
+func runAddSigner(args []string) error {
+	store, err := openStore()
+	checkerr(err)
+	if len(alias) > 0 && store.IsExistWalletByAlias(alias) {
+		cobra.CheckErr(fmt.Sprintf("Account with alias %s already exists.", alias))
+	}
+	config := nknwallet.SignerConfig{Command: args[0], Args: args[1:]}
+	wallet, err := store.AddExternal(config, signerAddress, alias)
+	checkerr(err)
+
+	fmt.Printf("External account %d (%s) saved successfully.\n", wallet.ID, wallet.Address())
+	return nil
+}
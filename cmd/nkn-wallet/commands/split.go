@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var splitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Split the seed of an account into shares (Shamir's secret sharing)",
+	Long: `Split the seed of an account into --shares shares of which any --threshold
+rebuild it with "restore --share". Every share is printed as 27 BIP39 words
+with checksum.
+
+With --share-recipient the shares are age encrypted, the first share to the
+first recipient and so on. A recipient is an age or SSH public key or a file
+of recipients.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		cmd.MarkFlagRequired("index")
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSplit()
+	},
+}
+
+var (
+	shareCount      int
+	shareThreshold  int
+	shareRecipients []string
+	shareDir        string
+)
+
+func init() {
+	rootCmd.AddCommand(splitCmd)
+
+	splitCmd.Flags().IntVar(&shareCount, "shares", 3, "Number of shares.")
+	splitCmd.Flags().IntVar(&shareThreshold, "threshold", 2, "Number of shares needed to restore the account.")
+	splitCmd.Flags().StringArrayVar(&shareRecipients, "share-recipient", nil, "Encrypt the next share to this recipient or recipient file. Repeat once per share.")
+	splitCmd.Flags().StringVar(&shareDir, "out", "", "Write the shares to share-<n>.txt (or .age) files in this directory instead of printing them.")
+}
+
+func runSplit() error {
+	if len(shareRecipients) > 0 && len(shareRecipients) != shareCount {
+		cobra.CheckErr(fmt.Sprintf("Got %d share recipients for %d shares.", len(shareRecipients), shareCount))
+	}
+
+	store, err := openStore()
+	checkerr(err)
+
+	var recipients [][]age.Recipient
+	for _, r := range shareRecipients {
+		recs, err := parseRecipientArg(store, r)
+		checkerr(err)
+		recipients = append(recipients, recs)
+	}
+
+	wallet, err := getWallet(store, index)
+	checkerr(err)
+	shares, err := wallet.Shares(shareCount, shareThreshold)
+	checkerr(err)
+
+	fmt.Printf("Account %d (%s) split into %d shares, %d needed to restore it.\n", wallet.ID, wallet.Address(), shareCount, shareThreshold)
+	for i, sh := range shares {
+		var out, ext string
+		if recipients != nil {
+			out, err = nknwallet.EncryptShare(sh, recipients[i])
+			ext = ".age"
+		} else {
+			out, err = sh.Mnemonic()
+			out += "\n"
+			ext = ".txt"
+		}
+		checkerr(err)
+
+		if len(shareDir) == 0 {
+			fmt.Printf("\nShare %d:\n%s", sh.X, out)
+			continue
+		}
+		checkerr(os.MkdirAll(shareDir, 0700))
+		file := filepath.Join(shareDir, fmt.Sprintf("share-%d%s", sh.X, ext))
+		checkerr(os.WriteFile(file, []byte(out), 0600))
+		fmt.Printf("Share %d written to %s.\n", sh.X, file)
+	}
+
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/nknorg/nkn/v2/common"
-	nknwallet "github.com/omani/nkn-wallet"
 	"github.com/spf13/cobra"
 )
 
@@ -40,9 +39,9 @@ func runTransfer() error {
 	_, err := common.ToScriptHash(to)
 	checkerr(err)
 
-	store, err := nknwallet.NewStore(path)
+	store, err := openStore()
 	checkerr(err)
-	wallet, err := getWallet(store, index)
+	wallet, err := getSigningWallet(store, index)
 	checkerr(err)
 
 	if amount == "all" {
@@ -0,0 +1,316 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/table"
+	nknwallet "github.com/omani/nkn-wallet"
+	"github.com/spf13/cobra"
+)
+
+var txCmd = &cobra.Command{
+	Use:   "tx",
+	Short: "Build, sign and broadcast transactions for offline (air-gapped) accounts",
+	Long: `Build, sign and broadcast transactions for offline (air-gapped) accounts.
+
+  1. online:   nkn-wallet tx build transfer --index 1 --to NKN... --amount 10 --out tx.json
+  2. offline:  nkn-wallet tx sign tx.json
+  3. online:   nkn-wallet tx broadcast tx.json
+
+On the online machine the cold account can be a watch-only account (add-watch;
+name and subscription transactions need its --pubkey). The transaction file
+holds the unsigned transaction, a summary, its hash and a checksum. Each step
+checks that nothing was changed and shows the summary decoded from the
+transaction itself.`,
+}
+
+var txBuildCmd = &cobra.Command{
+	Use:       "build <transfer|register-name|transfer-name|delete-name|subscribe|unsubscribe>",
+	Short:     "Build an unsigned transaction and write it to a file",
+	ValidArgs: []string{nknwallet.TxTransfer, nknwallet.TxRegisterName, nknwallet.TxTransferName, nknwallet.TxDeleteName, nknwallet.TxSubscribe, nknwallet.TxUnsubscribe},
+	Args:      cobra.ExactValidArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		cmd.MarkFlagRequired("index")
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTxBuild(args[0])
+	},
+}
+
+var txSignCmd = &cobra.Command{
+	Use:   "sign <file>",
+	Short: "Sign the transaction of a file with its sender account",
+	Long: `Sign the transaction of a file with its sender account, found by its address
+unless --index is given. The summary is shown before signing. The signed
+transaction is added to the file, or written to --out.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTxSign(args[0])
+	},
+}
+
+var txBroadcastCmd = &cobra.Command{
+	Use:   "broadcast <file>",
+	Short: "Send the signed transaction of a file to the NKN network",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTxBroadcast(args[0])
+	},
+}
+
+var txDecodeCmd = &cobra.Command{
+	Use:   "decode [<hex>|<file>|-]",
+	Short: "Decode a raw transaction and print every field",
+	Long: `Decode a raw transaction and print every field: payload type, sender,
+recipient, amount, fee, nonce, attributes and programs, and whether the
+signatures verify against the program hash of the sender.
+
+The transaction is a protobuf encoded transaction.Transaction, hex encoded or
+raw, given as argument, in a file or on stdin. Transaction files of tx build
+and tx sign are decoded too, showing the signed transaction once signed.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTxDecode(args)
+	},
+}
+
+var (
+	txJSON            bool
+	txOut             string
+	txNonce           int64
+	txPubKey          string
+	txRecipientPubKey string
+	txName            string
+	txTopic           string
+	txIdentifier      string
+	txDuration        uint32
+	txMeta            string
+	txYes             bool
+)
+
+func init() {
+	rootCmd.AddCommand(txCmd)
+	txCmd.AddCommand(txBuildCmd)
+	txCmd.AddCommand(txSignCmd)
+	txCmd.AddCommand(txBroadcastCmd)
+	txCmd.AddCommand(txDecodeCmd)
+
+	txBuildCmd.Flags().StringVarP(&txOut, "out", "o", "", "Write the transaction file here.")
+	txBuildCmd.Flags().StringVar(&to, "to", "", "NKN address of the recipient of a transfer.")
+	txBuildCmd.Flags().StringVar(&amount, "amount", "", "Amount of a transfer.")
+	txBuildCmd.Flags().StringVar(&fee, "fee", "", "Fee of the transaction.")
+	txBuildCmd.Flags().Int64Var(&txNonce, "nonce", -1, "Nonce of the transaction (default fetched from the network).")
+	txBuildCmd.Flags().StringVar(&txPubKey, "pubkey", "", "Hex encoded public key of the sender, if the wallet doesn't know it.")
+	txBuildCmd.Flags().StringVar(&txRecipientPubKey, "recipient-pubkey", "", "Hex encoded public key a name is transferred to.")
+	txBuildCmd.Flags().StringVar(&txName, "name", "", "Name to register, transfer or delete.")
+	txBuildCmd.Flags().StringVar(&txTopic, "topic", "", "Topic to (un)subscribe.")
+	txBuildCmd.Flags().StringVar(&txIdentifier, "identifier", "", "Identifier of the subscriber.")
+	txBuildCmd.Flags().Uint32Var(&txDuration, "duration", 0, "Duration of the subscription in blocks.")
+	txBuildCmd.Flags().StringVar(&txMeta, "meta", "", "Meta data of the subscription.")
+	txBuildCmd.MarkFlagRequired("out")
+
+	txSignCmd.Flags().StringVarP(&txOut, "out", "o", "", "Write the signed transaction file here instead of updating the file.")
+	txSignCmd.Flags().BoolVarP(&txYes, "yes", "y", false, "Sign without asking.")
+
+	txDecodeCmd.Flags().BoolVar(&txJSON, "json", false, "Print the transaction as JSON.")
+}
+
+func runTxBuild(kind string) error {
+	store, err := openStore()
+	checkerr(err)
+	wallet, err := store.NewQueryWallet(index, nil)
+	checkerr(err)
+
+	pubKey := wallet.PubKey()
+	if len(txPubKey) > 0 {
+		pubKey, err = hex.DecodeString(txPubKey)
+		if err != nil {
+			cobra.CheckErr("Public key must be hex encoded.")
+		}
+	}
+	recipientPubKey, err := hex.DecodeString(txRecipientPubKey)
+	if err != nil {
+		cobra.CheckErr("Public key of the recipient must be hex encoded.")
+	}
+	if kind != nknwallet.TxTransfer && len(pubKey) == 0 {
+		cobra.CheckErr("Public key of the account is unknown. Give it with --pubkey.")
+	}
+
+	nonce := txNonce
+	if nonce < 0 {
+		nonce, err = wallet.GetNonce(true)
+		checkerr(err)
+	}
+
+	tx, err := nknwallet.BuildTx(kind, nknwallet.TxParams{
+		Sender:          wallet.Address(),
+		PubKey:          pubKey,
+		Recipient:       to,
+		RecipientPubKey: recipientPubKey,
+		Amount:          amount,
+		Fee:             fee,
+		Nonce:           uint64(nonce),
+		Name:            txName,
+		Topic:           txTopic,
+		Identifier:      txIdentifier,
+		Duration:        txDuration,
+		Meta:            txMeta,
+	})
+	checkerr(err)
+	ftx, err := nknwallet.NewOfflineTx(tx)
+	checkerr(err)
+	checkerr(ftx.Write(txOut))
+
+	printTxSummary(ftx.Summary)
+	fmt.Printf("Unsigned transaction %s written to %s.\n", ftx.Hash, txOut)
+	return nil
+}
+
+func runTxSign(file string) error {
+	ftx, err := nknwallet.ReadOfflineTx(file)
+	checkerr(err)
+	if ftx.Signed() {
+		cobra.CheckErr(fmt.Sprintf("Transaction %s is signed already.", ftx.Hash))
+	}
+
+	store, err := openStore()
+	checkerr(err)
+	signIndex := index
+	if signIndex == 0 {
+		for _, w := range store.GetWallets() {
+			if w.Address() == ftx.Summary.Sender {
+				signIndex = w.ID
+				break
+			}
+		}
+		if signIndex == 0 {
+			cobra.CheckErr(fmt.Sprintf("No account of the wallet has the address %s of the sender.", ftx.Summary.Sender))
+		}
+	}
+
+	printTxSummary(ftx.Summary)
+	if !txYes && !confirm(fmt.Sprintf("Sign transaction %s with account %d?", ftx.Hash, signIndex)) {
+		cobra.CheckErr("Transaction not signed.")
+	}
+
+	wallet, err := getSigningWallet(store, signIndex)
+	checkerr(err)
+	checkerr(ftx.Sign(wallet))
+
+	out := file
+	if len(txOut) > 0 {
+		out = txOut
+	}
+	checkerr(ftx.Write(out))
+	fmt.Printf("Signed transaction %s written to %s.\n", ftx.Hash, out)
+	return nil
+}
+
+func runTxBroadcast(file string) error {
+	ftx, err := nknwallet.ReadOfflineTx(file)
+	checkerr(err)
+	if !ftx.Signed() {
+		cobra.CheckErr("Transaction is not signed yet. Sign it with: nkn-wallet tx sign " + file)
+	}
+
+	printTxSummary(ftx.Summary)
+	txhash, err := ftx.Broadcast(context.Background(), nil)
+	checkerr(err)
+
+	fmt.Printf("Successfully broadcast transaction. txHash: %s\n", txhash)
+	return nil
+}
+
+func runTxDecode(args []string) error {
+	var dat []byte
+	var err error
+	switch {
+	case len(args) == 0 || args[0] == "-":
+		dat, err = io.ReadAll(os.Stdin)
+	case fileExists(args[0]):
+		dat, err = os.ReadFile(args[0])
+	default:
+		dat = []byte(args[0])
+	}
+	checkerr(err)
+
+	if trimmed := bytes.TrimSpace(dat); len(trimmed) > 0 && trimmed[0] == '{' {
+		ftx := &nknwallet.OfflineTx{}
+		checkerr(json.Unmarshal(trimmed, ftx))
+		if err := ftx.Verify(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		dat = []byte(ftx.Tx)
+		if ftx.Signed() {
+			dat = []byte(ftx.SignedTx)
+		}
+	}
+
+	tx, err := nknwallet.DecodeTx(dat)
+	checkerr(err)
+	info, err := nknwallet.InspectTx(tx)
+	checkerr(err)
+
+	if txJSON {
+		out, err := json.MarshalIndent(info, "", "  ")
+		checkerr(err)
+		fmt.Println(string(out))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateColumns = false
+	t.SetOutputMirror(os.Stdout)
+	t.AppendRow(table.Row{"Hash:", info.Hash})
+	t.AppendRow(table.Row{"Payload type:", info.PayloadType})
+	for _, f := range info.Fields() {
+		t.AppendRow(table.Row{strings.ToUpper(f[0][:1]) + f[0][1:] + ":", f[1]})
+	}
+	t.AppendRow(table.Row{"Size:", fmt.Sprintf("%d bytes", info.Size)})
+	for i, p := range info.Programs {
+		label := fmt.Sprintf("Program %d:", i+1)
+		t.AppendRow(table.Row{label, "address " + p.Address})
+		t.AppendRow(table.Row{"", "public key " + p.PublicKey})
+		t.AppendRow(table.Row{"", "signature " + p.Signature})
+	}
+	switch {
+	case !info.Signed:
+		t.AppendRow(table.Row{"Signature:", "none, the transaction is unsigned"})
+	case info.SignatureValid:
+		t.AppendRow(table.Row{"Signature:", "valid"})
+	default:
+		t.AppendRow(table.Row{"Signature:", "INVALID: " + info.SignatureError})
+	}
+	t.Render()
+
+	if info.Signed && !info.SignatureValid {
+		cobra.CheckErr("Signature of the transaction is invalid.")
+	}
+	return nil
+}
+
+func fileExists(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && !fi.IsDir()
+}
+
+func printTxSummary(summary *nknwallet.TxSummary) {
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateColumns = false
+	t.SetOutputMirror(os.Stdout)
+	for _, f := range summary.Fields() {
+		t.AppendRow(table.Row{strings.ToUpper(f[0][:1]) + f[0][1:] + ":", f[1]})
+	}
+	t.Render()
+}
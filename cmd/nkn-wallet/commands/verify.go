@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/spf13/cobra"
+)
+
+var verifyPolicyCmd = &cobra.Command{
+	Use:   "verify-policy",
+	Short: "Check that every account can be decrypted by the recovery recipients",
+	Long: `Check that every account can be decrypted by the recovery recipients of the
+wallet and list the accounts that can't.
+
+Without --recovery-identity the age stanzas of the armors are inspected. SSH
+recipients are identified by their tag; X25519 recipients can't be told
+apart, so for them the recipients recorded with the account are trusted.
+With the identity file of a recovery key every account is actually
+decrypted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVerifyPolicy()
+	},
+}
+
+var recoveryIdentity string
+
+func init() {
+	rootCmd.AddCommand(verifyPolicyCmd)
+
+	verifyPolicyCmd.Flags().StringVar(&recoveryIdentity, "recovery-identity", "", "Identity file of a recovery key to decrypt every account with.")
+}
+
+func runVerifyPolicy() error {
+	store, err := openStore()
+	checkerr(err)
+
+	violations, err := store.VerifyPolicy(recoveryIdentity)
+	checkerr(err)
+	if len(violations) == 0 {
+		fmt.Printf("All %d accounts satisfy the recovery policy.\n", len(store.GetWallets()))
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetStyle(table.StyleRounded)
+	t.Style().Options.DrawBorder = false
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"ID", "Address", "Problem"})
+	for _, v := range violations {
+		t.AppendRow(table.Row{v.ID, v.Address, v.Reason})
+	}
+	t.Render()
+
+	cobra.CheckErr(fmt.Sprintf("%d accounts don't satisfy the recovery policy.", len(violations)))
+	return nil
+}
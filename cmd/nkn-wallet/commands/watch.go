@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var addWatchCmd = &cobra.Command{
+	Use:   "add-watch <address>",
+	Short: "Add a watch-only account tracked by its address alone",
+	Long: `Add a watch-only account tracked by its address alone.
+
+The wallet holds no key for watch-only accounts, e.g. cold storage or customer
+addresses. Their balance and transactions are shown without identity file or
+passphrase; transfers from them are refused.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAddWatch(args[0])
+	},
+}
+
+var watchPubKey string
+
+func init() {
+	rootCmd.AddCommand(addWatchCmd)
+
+	addWatchCmd.Flags().StringVar(&watchPubKey, "pubkey", "", "Hex encoded public key of the account (optional).")
+	addWatchCmd.Flags().StringVar(&alias, "alias", "", "Alias of the account.")
+}
+
+func runAddWatch(address string) error {
+	pubKey, err := hex.DecodeString(watchPubKey)
+	if err != nil {
+		cobra.CheckErr("Public key must be hex encoded.")
+	}
+
+	store, err := openStore()
+	checkerr(err)
+	if len(alias) > 0 && store.IsExistWalletByAlias(alias) {
+		cobra.CheckErr(fmt.Sprintf("Account with alias %s already exists.", alias))
+	}
+	wallet, err := store.AddWatch(address, pubKey, alias)
+	checkerr(err)
+
+	fmt.Printf("Watch-only account %d (%s) saved successfully.\n", wallet.ID, wallet.Address())
+	return nil
+}
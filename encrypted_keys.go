@@ -17,6 +17,9 @@ import (
 // ScryptIdentity.
 type LazyScryptIdentity struct {
 	Passphrase func() (string, error)
+	// MaxWorkFactor raises the maximum scrypt work factor accepted above
+	// the default of age, if set.
+	MaxWorkFactor int
 }
 
 var _ age.Identity = &LazyScryptIdentity{}
@@ -33,6 +36,9 @@ func (i *LazyScryptIdentity) Unwrap(stanzas []*age.Stanza) (fileKey []byte, err
 	if err != nil {
 		return nil, err
 	}
+	if i.MaxWorkFactor > 0 {
+		ii.SetMaxWorkFactor(i.MaxWorkFactor)
+	}
 	fileKey, err = ii.Unwrap(stanzas)
 	if errors.Is(err, age.ErrIncorrectIdentity) {
 		return nil, fmt.Errorf("incorrect passphrase")
@@ -82,7 +88,7 @@ func (i *EncryptedIdentity) Unwrap(stanzas []*age.Stanza) (fileKey []byte, err e
 }
 
 func (i *EncryptedIdentity) decrypt() error {
-	d, err := age.Decrypt(bytes.NewReader(i.Contents), &LazyScryptIdentity{i.Passphrase})
+	d, err := age.Decrypt(bytes.NewReader(i.Contents), &LazyScryptIdentity{Passphrase: i.Passphrase})
 	if e := new(age.NoIdentityMatchError); errors.As(err, &e) {
 		return fmt.Errorf("identity file is encrypted with age but not with a passphrase")
 	}
@@ -0,0 +1,142 @@
+package nknwallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StoreFormatVersion is the version of the wallet file format written by this
+// package. Wallet files with a higher version are refused.
+const StoreFormatVersion = 1
+
+// StoreHeader holds the store-level metadata of a wallet file.
+type StoreHeader struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Settings  StoreSettings `json:"settings"`
+}
+
+// StoreSettings holds settings that apply to the whole store rather than to a
+// single account.
+type StoreSettings struct {
+	// EncryptMetadata seals all accounts, including their metadata, in a
+	// single age envelope.
+	EncryptMetadata bool `json:"encrypt_metadata,omitempty"`
+	// MetadataKeyType is what the metadata is sealed with,
+	// MetadataKeyPassphrase or MetadataKeyRecipients.
+	MetadataKeyType string `json:"metadata_key,omitempty"`
+	// MetadataRecipients are the recipients the metadata is sealed to, so
+	// that saving the store never locks out the other recipients.
+	MetadataRecipients []string `json:"metadata_recipients,omitempty"`
+	// Master is the encrypted master secret accounts are derived from in HD
+	// mode.
+	Master *MasterSecret `json:"master,omitempty"`
+	// RecoveryRecipients are break-glass recipients every new or rekeyed
+	// account is also encrypted to.
+	RecoveryRecipients []string `json:"recovery_recipients,omitempty"`
+	// Recipients is the recipient registry: names like "alice" or
+	// "ops-group" and the age or SSH recipients and other names they stand
+	// for.
+	Recipients map[string][]string `json:"recipients,omitempty"`
+	// ScryptWorkFactor is the scrypt work factor new passphrases are
+	// encrypted with. Zero means DefaultScryptWorkFactor.
+	ScryptWorkFactor int `json:"scrypt_work_factor,omitempty"`
+	// KeyServer is the URL the SSH keys of "github:<user>" recipients are
+	// fetched from as <server>/<user>.keys. Empty means DefaultKeyServer.
+	KeyServer string `json:"key_server,omitempty"`
+	// PinnedKeys are the keys fetched for "github:<user>" recipients, which
+	// are used instead of fetching them again.
+	PinnedKeys map[string]*PinnedKeys `json:"pinned_keys,omitempty"`
+}
+
+// UnsupportedVersionError is returned when a wallet file was written by a newer
+// version of nkn-wallet than the one reading it.
+type UnsupportedVersionError struct {
+	Version int
+}
+
+func (e UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("Wallet file format version %d is not supported (latest supported version is %d). Upgrade nkn-wallet.", e.Version, StoreFormatVersion)
+}
+
+// Envelope is the versioned document a Backend persists: the store header
+// and its accounts. With metadata encryption enabled the accounts are stored
+// age encrypted in Sealed and Accounts is empty.
+type Envelope struct {
+	Header   StoreHeader `json:"header"`
+	Accounts []*Wallet   `json:"accounts"`
+	Sealed   string      `json:"sealed,omitempty"`
+}
+
+// migrations upgrade an envelope from the version it is indexed with to the
+// next version. Version 0 is the legacy bare JSON array of accounts.
+var migrations = []func(e *Envelope) error{
+	0: migrateV0,
+}
+
+// NewEnvelope returns an empty envelope of the current format version.
+func NewEnvelope() *Envelope {
+	now := time.Now().UTC()
+	return &Envelope{
+		Header: StoreHeader{
+			Version:   StoreFormatVersion,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+	}
+}
+
+// DecodeEnvelope parses the content of a wallet file. A legacy bare array of
+// accounts is returned as an envelope of version 0 and empty content as a new
+// envelope. The envelope is not migrated.
+func DecodeEnvelope(dat []byte) (*Envelope, error) {
+	dat = bytes.TrimSpace(dat)
+	if len(dat) == 0 {
+		return NewEnvelope(), nil
+	}
+
+	e := &Envelope{}
+	if dat[0] == '[' {
+		if err := json.Unmarshal(dat, &e.Accounts); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	if err := json.Unmarshal(dat, e); err != nil {
+		return nil, err
+	}
+	if e.Header.Version == 0 {
+		return nil, errors.New("Wallet file is missing format version information.")
+	}
+	return e, nil
+}
+
+// migrateEnvelope upgrades e to StoreFormatVersion and reports whether a
+// migration took place and the envelope should be written back.
+func migrateEnvelope(e *Envelope) (bool, error) {
+	if e.Header.Version > StoreFormatVersion {
+		return false, UnsupportedVersionError{e.Header.Version}
+	}
+
+	migrated := false
+	for e.Header.Version < StoreFormatVersion {
+		if err := migrations[e.Header.Version](e); err != nil {
+			return false, fmt.Errorf("could not migrate wallet file from version %d: %v", e.Header.Version, err)
+		}
+		e.Header.Version++
+		migrated = true
+	}
+	return migrated, nil
+}
+
+// migrateV0 wraps a legacy bare array of accounts into the versioned envelope.
+func migrateV0(e *Envelope) error {
+	now := time.Now().UTC()
+	e.Header.CreatedAt = now
+	e.Header.UpdatedAt = now
+	return nil
+}
@@ -11,6 +11,7 @@ require (
 	github.com/omani/nkn-openapi-client v0.0.0-20230805145843-56572fd10092
 	github.com/spf13/cobra v1.7.1-0.20230723113155-fd865a44e3c4
 	golang.org/x/crypto v0.12.0
+	golang.org/x/sys v0.11.0
 )
 
 require (
@@ -39,7 +40,6 @@ require (
 	go.mongodb.org/mongo-driver v1.12.1 // indirect
 	golang.org/x/mobile v0.0.0-20230531173138-3c911d8e3eda // indirect
 	golang.org/x/net v0.14.0 // indirect
-	golang.org/x/sys v0.11.0 // indirect
 	golang.org/x/term v0.11.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
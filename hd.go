@@ -0,0 +1,297 @@
+package nknwallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+// DefaultDerivationPath is the parent path below which accounts are derived
+// from the master secret of a store. Account i is derived at
+// DefaultDerivationPath/i'.
+const DefaultDerivationPath = "m/0'"
+
+// DefaultGapLimit is the number of consecutive unused accounts after which
+// ScanDerived stops looking for more.
+const DefaultGapLimit = 20
+
+// MasterSecretSize is the size in bytes of a master secret created by
+// NewMasterSecret.
+const MasterSecretSize = 32
+
+const hardenedOffset = 0x80000000
+
+// MasterSecret is the age encrypted master secret of a store in HD mode.
+type MasterSecret struct {
+	Type  string `json:"type"`
+	Path  string `json:"path"`
+	Armor string `json:"armor"`
+}
+
+// NewMasterSecret returns a random master secret.
+func NewMasterSecret() ([]byte, error) {
+	master := make([]byte, MasterSecretSize)
+	if _, err := rand.Read(master); err != nil {
+		return nil, err
+	}
+	return master, nil
+}
+
+// parsePath parses a derivation path like "m/0'/1'". Only hardened indices
+// are allowed, as SLIP-0010 does not define public derivation for ed25519.
+func parsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q must start with \"m\"", path)
+	}
+
+	var indices []uint32
+	for _, p := range parts[1:] {
+		n := strings.TrimRight(p, "'h")
+		if len(p)-len(n) != 1 {
+			return nil, fmt.Errorf("derivation path %q: index %q is not hardened (ed25519 only supports hardened derivation)", path, p)
+		}
+		i, err := strconv.ParseUint(n, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("derivation path %q: invalid index %q", path, p)
+		}
+		indices = append(indices, uint32(i)+hardenedOffset)
+	}
+	return indices, nil
+}
+
+// DeriveSeed derives the account seed at path from master following SLIP-0010
+// for ed25519. The seed can be passed to nkn.NewAccount.
+func DeriveSeed(master []byte, path string) ([]byte, error) {
+	indices, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha512.New, []byte("ed25519 seed"))
+	mac.Write(master)
+	sum := mac.Sum(nil)
+	key, chainCode := sum[:32], sum[32:]
+
+	for _, i := range indices {
+		data := make([]byte, 0, 37)
+		data = append(data, 0)
+		data = append(data, key...)
+		data = binary.BigEndian.AppendUint32(data, i)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		key, chainCode = sum[:32], sum[32:]
+	}
+	return key, nil
+}
+
+// derivationPath returns the path of the account with index i below parent.
+func derivationPath(parent string, i int) string {
+	return fmt.Sprintf("%s/%d'", parent, i)
+}
+
+// HasMasterSecret reports whether the store holds a master secret.
+func (s *Store) HasMasterSecret() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.header.Settings.Master != nil
+}
+
+// SetMasterSecret encrypts master to recipients and stores it as the master
+// secret of the store. Accounts are derived below path, or below
+// DefaultDerivationPath if path is empty. A store holds at most one master
+// secret.
+func (s *Store) SetMasterSecret(master []byte, path string, recipients []age.Recipient) error {
+	if len(path) == 0 {
+		path = DefaultDerivationPath
+	}
+	if _, err := parsePath(path); err != nil {
+		return err
+	}
+
+	typ := "IDENTITY"
+	if isScrypt(recipients) {
+		typ = "SCRYPT"
+	}
+
+	out := &bytes.Buffer{}
+	if err := encrypt(recipients, bytes.NewReader(master), out); err != nil {
+		return err
+	}
+
+	return s.update(func() error {
+		if s.header.Settings.Master != nil {
+			return errors.New("Wallet already has a master secret.")
+		}
+		s.header.Settings.Master = &MasterSecret{
+			Type:  typ,
+			Path:  path,
+			Armor: out.String(),
+		}
+		return nil
+	})
+}
+
+// MasterSecretByIdentity decrypts the master secret of the store with the
+// identity file.
+func (s *Store) MasterSecretByIdentity(identity string) ([]byte, error) {
+	ids, err := parseIdentitiesFile(identity, s.PassphraseProvider())
+	if err != nil {
+		return nil, err
+	}
+	return s.decryptMasterSecret(append([]age.Identity{rejectScryptIdentity{}}, ids...))
+}
+
+// MasterSecretByPassword prompts for the passphrase and decrypts the master
+// secret of the store.
+func (s *Store) MasterSecretByPassword() ([]byte, error) {
+	s.mu.RLock()
+	var max int
+	if m := s.header.Settings.Master; m != nil {
+		max = armorWorkFactor(m.Armor)
+	}
+	s.mu.RUnlock()
+	return s.decryptMasterSecret([]age.Identity{&LazyScryptIdentity{Passphrase: passphraseFunc(s.PassphraseProvider(), "Enter passphrase"), MaxWorkFactor: max}})
+}
+
+func (s *Store) decryptMasterSecret(identities []age.Identity) ([]byte, error) {
+	s.mu.RLock()
+	m := s.header.Settings.Master
+	s.mu.RUnlock()
+	if m == nil {
+		return nil, errors.New("Wallet has no master secret.")
+	}
+
+	out := &bytes.Buffer{}
+	if err := decrypt(identities, bytes.NewBufferString(m.Armor), out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// DerivationPath returns the path of the derived account with index i.
+func (s *Store) DerivationPath(i int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.header.Settings.Master == nil {
+		return "", errors.New("Wallet has no master secret.")
+	}
+	return derivationPath(s.header.Settings.Master.Path, i), nil
+}
+
+// DeriveSeedByIndex derives the seed of the account with index i from the
+// master secret of the store, returning the seed and its derivation path.
+func (s *Store) DeriveSeedByIndex(master []byte, i int) ([]byte, string, error) {
+	s.mu.RLock()
+	m := s.header.Settings.Master
+	s.mu.RUnlock()
+	if m == nil {
+		return nil, "", errors.New("Wallet has no master secret.")
+	}
+	return DeriveSeedBelow(master, m.Path, i)
+}
+
+// DeriveSeedBelow derives the seed of the account with index i below the
+// parent path from master, returning the seed and its derivation path. If
+// parent is empty DefaultDerivationPath is used.
+func DeriveSeedBelow(master []byte, parent string, i int) ([]byte, string, error) {
+	if len(parent) == 0 {
+		parent = DefaultDerivationPath
+	}
+	path := derivationPath(parent, i)
+	seed, err := DeriveSeed(master, path)
+	if err != nil {
+		return nil, "", err
+	}
+	return seed, path, nil
+}
+
+// NextDerivationIndex returns the lowest index above all derived accounts in
+// the store.
+func (s *Store) NextDerivationIndex() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.header.Settings.Master == nil {
+		return 0
+	}
+	prefix := s.header.Settings.Master.Path + "/"
+
+	next := 0
+	for _, w := range s.wallets {
+		if !strings.HasPrefix(w.Path, prefix) {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimRight(strings.TrimPrefix(w.Path, prefix), "'h"))
+		if err == nil && i >= next {
+			next = i + 1
+		}
+	}
+	return next
+}
+
+// ScanDerived derives the accounts of the master secret in order and calls
+// used with their addresses. It returns the indices of all used accounts,
+// stopping after gapLimit consecutive unused ones.
+func (s *Store) ScanDerived(master []byte, gapLimit int, used func(i int, address string) (bool, error)) ([]int, error) {
+	if gapLimit <= 0 {
+		gapLimit = DefaultGapLimit
+	}
+
+	var indices []int
+	for i, gap := 0, 0; gap < gapLimit; i++ {
+		seed, _, err := s.DeriveSeedByIndex(master, i)
+		if err != nil {
+			return nil, err
+		}
+		account, err := nkn.NewAccount(seed)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := used(i, account.WalletAddress())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			indices = append(indices, i)
+			gap = 0
+		} else {
+			gap++
+		}
+	}
+	return indices, nil
+}
+
+// IsAddressUsed reports whether address has a balance or has ever sent a
+// transaction, looked up through the RPC servers of config.
+func IsAddressUsed(ctx context.Context, address string, config *nkn.WalletConfig) (bool, error) {
+	config, err := nkn.MergeWalletConfig(config)
+	if err != nil {
+		return false, err
+	}
+
+	nonce, err := nkn.GetNonceContext(ctx, address, true, config)
+	if err != nil {
+		return false, err
+	}
+	if nonce > 0 {
+		return true, nil
+	}
+
+	balance, err := nkn.GetBalanceContext(ctx, address, config)
+	if err != nil {
+		return false, err
+	}
+	return balance.Fixed64 > 0, nil
+}
@@ -0,0 +1,104 @@
+package nknwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+func TestDeriveSeed(t *testing.T) {
+	// SLIP-0010 test vector 1 for ed25519
+	master, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"m", "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+		{"m/0'", "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3"},
+		{"m/0'/1'", "b1d0bad404bf35da785a64ca1ac54b2617211d2777696fbffaf208f746ae84f2"},
+		{"m/0'/1'/2'", "92a5b23c0b8a99e37d07df3fb9966917f5d06e02ddbd909c7e184371463e9fc9"},
+		{"m/0'/1'/2'/2'", "30d1dc7e5fc04c31219ab25a27ae00b50f6fd66622f6e9c913253d6511d1e662"},
+		{"m/0'/1'/2'/2'/1000000000'", "8f94d394a8e8fd6b1bc2f3f49f5c47e385281d5c17e65324b0f62483e37e8793"},
+		{"m/0h/1h/2h/2h/1000000000h", "8f94d394a8e8fd6b1bc2f3f49f5c47e385281d5c17e65324b0f62483e37e8793"},
+	}
+	for _, tt := range tests {
+		key, err := DeriveSeed(master, tt.path)
+		if err != nil {
+			t.Errorf("DeriveSeed(%s): %v", tt.path, err)
+			continue
+		}
+		if hex.EncodeToString(key) != tt.key {
+			t.Errorf("DeriveSeed(%s) = %x, want %s", tt.path, key, tt.key)
+		}
+	}
+
+	for _, path := range []string{"", "0'", "m/0", "m/0'/1", "m/x'", "m/2147483648'"} {
+		if _, err := DeriveSeed(master, path); err == nil {
+			t.Errorf("DeriveSeed(%q) succeeded", path)
+		}
+	}
+}
+
+func TestScanDerived(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := bytes.Repeat([]byte{7}, MasterSecretSize)
+	s, err := NewStore("", WithBackend(NewMemBackend()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMasterSecret(master, "", []age.Recipient{id.Recipient()}); err != nil {
+		t.Fatal(err)
+	}
+
+	used := map[int]bool{0: true, 3: true, 9: true}
+	tests := []struct {
+		gapLimit int
+		want     []int
+		scanned  int
+	}{
+		{gapLimit: 2, want: []int{0}, scanned: 3},
+		{gapLimit: 5, want: []int{0, 3}, scanned: 9},
+		{gapLimit: 6, want: []int{0, 3, 9}, scanned: 16},
+		{gapLimit: 0, want: []int{0, 3, 9}, scanned: 10 + DefaultGapLimit},
+	}
+	for _, tt := range tests {
+		scanned := 0
+		got, err := s.ScanDerived(master, tt.gapLimit, func(i int, address string) (bool, error) {
+			if i != scanned {
+				t.Fatalf("scanned account %d, want %d", i, scanned)
+			}
+			scanned++
+			seed, err := DeriveSeed(master, derivationPath(DefaultDerivationPath, i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			account, err := nkn.NewAccount(seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if address != account.WalletAddress() {
+				t.Fatalf("address of account %d is %s, want %s", i, address, account.WalletAddress())
+			}
+			return used[i], nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) || scanned != tt.scanned {
+			t.Errorf("ScanDerived with gap limit %d = %v after %d accounts, want %v after %d", tt.gapLimit, got, scanned, tt.want, tt.scanned)
+		}
+	}
+
+	errUsed := errors.New("lookup failed")
+	if _, err := s.ScanDerived(master, 5, func(int, string) (bool, error) { return false, errUsed }); !errors.Is(err, errUsed) {
+		t.Fatalf("ScanDerived with a failing lookup = %v, want its error", err)
+	}
+}
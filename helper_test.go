@@ -0,0 +1,43 @@
+package nknwallet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests run the test binary itself as the external programs the wallet talks
+// to, e.g. age plugins and external signers. helperEnv selects the program.
+const helperEnv = "NKN_WALLET_TEST_HELPER"
+
+// helpers are the programs the test binary can act as, by name.
+var helpers = map[string]func() int{}
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv(helperEnv); len(name) > 0 {
+		helper, ok := helpers[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown test helper %q\n", name)
+			os.Exit(2)
+		}
+		os.Exit(helper())
+	}
+	os.Exit(m.Run())
+}
+
+// writeHelper writes an executable named file to dir that runs the test
+// binary as helper.
+func writeHelper(t *testing.T, dir, file, helper string) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, file)
+	script := fmt.Sprintf("#!/bin/sh\n%s=%s exec '%s' \"$@\"\n", helperEnv, helper, exe)
+	if err := os.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,208 @@
+package nknwallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Scrypt work factors are the base-2 logarithm of the scrypt cost parameter N.
+// Every step up doubles the time and memory needed to derive the key from a
+// passphrase, for the owner and an attacker alike.
+const (
+	// DefaultScryptWorkFactor is the work factor of age, used unless the
+	// store or the caller choose another one.
+	DefaultScryptWorkFactor = 18
+	// MinScryptWorkFactor and MaxScryptWorkFactor bound the work factors
+	// that can be chosen.
+	MinScryptWorkFactor = 10
+	MaxScryptWorkFactor = 30
+)
+
+// KDF describes how the key of a passphrase encrypted account is derived from
+// the passphrase.
+type KDF struct {
+	Name       string `json:"name"`
+	WorkFactor int    `json:"work_factor"`
+}
+
+// WithScryptWorkFactor sets the scrypt work factor of accounts encrypted with a
+// passphrase, overriding the default of the store.
+func WithScryptWorkFactor(n int) StoreOption {
+	return func(s *Store) {
+		s.scryptWorkFactor = n
+	}
+}
+
+func checkScryptWorkFactor(n int) error {
+	if n < MinScryptWorkFactor || n > MaxScryptWorkFactor {
+		return fmt.Errorf("Scrypt work factor must be between %d and %d.", MinScryptWorkFactor, MaxScryptWorkFactor)
+	}
+	return nil
+}
+
+// ScryptWorkFactor returns the scrypt work factor accounts are encrypted with:
+// the one set by WithScryptWorkFactor, the default of the store or
+// DefaultScryptWorkFactor.
+func (s *Store) ScryptWorkFactor() int {
+	if s.scryptWorkFactor > 0 {
+		return s.scryptWorkFactor
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if n := s.header.Settings.ScryptWorkFactor; n > 0 {
+		return n
+	}
+	return DefaultScryptWorkFactor
+}
+
+// SetScryptWorkFactor sets the default scrypt work factor of the store. Zero
+// resets it to DefaultScryptWorkFactor. Existing accounts are not changed; use
+// Reharden to re-encrypt them.
+func (s *Store) SetScryptWorkFactor(n int) error {
+	if n != 0 {
+		if err := checkScryptWorkFactor(n); err != nil {
+			return err
+		}
+	}
+	return s.update(func() error {
+		s.header.Settings.ScryptWorkFactor = n
+		return nil
+	})
+}
+
+// ScryptRecipient returns a recipient encrypting with pass and the scrypt work
+// factor of the store.
+func (s *Store) ScryptRecipient(pass string) (*age.ScryptRecipient, error) {
+	return newScryptRecipient(pass, s.ScryptWorkFactor())
+}
+
+func newScryptRecipient(pass string, workFactor int) (*age.ScryptRecipient, error) {
+	if err := checkScryptWorkFactor(workFactor); err != nil {
+		return nil, err
+	}
+	r, err := age.NewScryptRecipient(pass)
+	if err != nil {
+		return nil, err
+	}
+	r.SetWorkFactor(workFactor)
+	return r, nil
+}
+
+// armorWorkFactor returns the work factor of the scrypt stanza of armor, or 0
+// if it is not passphrase encrypted.
+func armorWorkFactor(armor string) int {
+	stanzas, err := armorStanzas(armor)
+	if err != nil {
+		return 0
+	}
+	for _, st := range stanzas {
+		if st.Type == "scrypt" && len(st.Args) == 2 {
+			n, _ := strconv.Atoi(st.Args[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// armorKDF returns the KDF of a passphrase encrypted armor, or nil.
+func armorKDF(armor string) *KDF {
+	if n := armorWorkFactor(armor); n > 0 {
+		return &KDF{Name: "scrypt", WorkFactor: n}
+	}
+	return nil
+}
+
+// ScryptWorkFactor returns the scrypt work factor the passphrase of the
+// account is derived with, or 0 if it is unknown or the account has no
+// passphrase.
+func (w *Wallet) ScryptWorkFactor() int {
+	if w.KDF != nil && w.KDF.Name == "scrypt" {
+		return w.KDF.WorkFactor
+	}
+	return armorWorkFactor(w.Armor)
+}
+
+// Reharden re-encrypts a SCRYPT or TWOFACTOR account with its passphrase pass
+// and a higher scrypt work factor. The outer layer of a TWOFACTOR account is
+// decrypted with the identity file and encrypted again to the same
+// recipients.
+func (s *Store) Reharden(wallet *Wallet, identity, pass string, workFactor int) error {
+	if current := wallet.ScryptWorkFactor(); current >= workFactor {
+		return fmt.Errorf("Account is encrypted with work factor %d already.", current)
+	}
+	r, err := newScryptRecipient(pass, workFactor)
+	if err != nil {
+		return err
+	}
+	passIdentity := &LazyScryptIdentity{
+		Passphrase:    func() (string, error) { return pass, nil },
+		MaxWorkFactor: wallet.ScryptWorkFactor(),
+	}
+
+	switch strings.ToLower(wallet.Type) {
+	case "scrypt":
+		account, err := decryptAccount(wallet.Armor, []age.Identity{passIdentity})
+		if err != nil {
+			return err
+		}
+		if account.WalletAddress() != wallet.Address() {
+			return errors.New("Decrypted account does not match the address.")
+		}
+		enc, err := s.encryptAccount(account, []age.Recipient{r})
+		if err != nil {
+			return err
+		}
+		return s.replaceArmor(wallet, "SCRYPT", enc, nil, nil, nil)
+	case "twofactor":
+		ids, err := parseIdentitiesFile(identity, s.PassphraseProvider())
+		if err != nil {
+			return err
+		}
+		inner, err := unwrapTwoFactor(wallet, ids)
+		if err != nil {
+			return err
+		}
+		account, err := decryptAccount(string(inner), []age.Identity{passIdentity})
+		if err != nil {
+			return err
+		}
+		if account.WalletAddress() != wallet.Address() {
+			return errors.New("Decrypted account does not match the address.")
+		}
+		recipients, err := identitiesToRecipients(ids)
+		if err != nil {
+			return err
+		}
+		names := recordedRecipients(recipients)
+		if len(wallet.Recipients) > 0 {
+			recipients, names = nil, wallet.Recipients
+			for _, name := range wallet.Recipients {
+				r, err := parseRecipient(name)
+				if err != nil {
+					return err
+				}
+				recipients = append(recipients, r)
+			}
+		}
+		newInner, err := encryptAccount(account, []age.Recipient{r})
+		if err != nil {
+			return err
+		}
+		armor, err := wrapTwoFactor(newInner, recipients)
+		if err != nil {
+			return err
+		}
+		enc := &encryptedAccount{
+			armor:         string(armor),
+			recoveryArmor: wallet.RecoveryArmor,
+			recovery:      wallet.Recovery,
+			kdf:           armorKDF(string(newInner)),
+		}
+		return s.replaceArmor(wallet, "TWOFACTOR", enc, names, wallet.NamedRecipients, newInner)
+	}
+	return errors.New("Account is not encrypted with a passphrase.")
+}
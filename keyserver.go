@@ -0,0 +1,188 @@
+package nknwallet
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+)
+
+// "github:<user>" recipients are the SSH keys a key server publishes for a
+// user at <server>/<user>.keys, like GitHub and GitLab do. The keys are
+// fetched once and pinned in the store, so the same recipient keeps standing
+// for the same keys and later rekeys don't depend on the key server.
+
+// DefaultKeyServer is where the keys of "github:<user>" recipients are fetched
+// from unless the store or the caller choose another one.
+const DefaultKeyServer = "https://github.com"
+
+// keyServerTimeout bounds fetching the keys of a user.
+const keyServerTimeout = 30 * time.Second
+
+var keyServerUserPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// PinnedKeys are the SSH keys fetched for a "github:<user>" recipient.
+type PinnedKeys struct {
+	URL       string    `json:"url"`
+	Keys      []string  `json:"keys"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// WithKeyServer sets the key server "github:<user>" recipients are fetched
+// from, overriding the key server of the store.
+func WithKeyServer(server string) StoreOption {
+	return func(s *Store) {
+		s.keyServer = server
+	}
+}
+
+func checkKeyServer(server string) error {
+	u, err := url.Parse(server)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+		return fmt.Errorf("Invalid key server %q. Use an http or https URL like %s.", server, DefaultKeyServer)
+	}
+	return nil
+}
+
+// KeyServer returns the key server "github:<user>" recipients are fetched
+// from: the one set by WithKeyServer, the one of the store or
+// DefaultKeyServer.
+func (s *Store) KeyServer() string {
+	if len(s.keyServer) > 0 {
+		return s.keyServer
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if server := s.header.Settings.KeyServer; len(server) > 0 {
+		return server
+	}
+	return DefaultKeyServer
+}
+
+// SetKeyServer sets the key server of the store. An empty server resets it to
+// DefaultKeyServer. Keys pinned already are not fetched again.
+func (s *Store) SetKeyServer(server string) error {
+	if len(server) > 0 {
+		if err := checkKeyServer(server); err != nil {
+			return err
+		}
+	}
+	return s.update(func() error {
+		s.header.Settings.KeyServer = strings.TrimSuffix(server, "/")
+		return nil
+	})
+}
+
+// PinnedKeys returns the keys pinned for "github:<user>" recipients.
+func (s *Store) PinnedKeys() map[string]PinnedKeys {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pins := map[string]PinnedKeys{}
+	for name, pin := range s.header.Settings.PinnedKeys {
+		pins[name] = PinnedKeys{URL: pin.URL, Keys: append([]string{}, pin.Keys...), FetchedAt: pin.FetchedAt}
+	}
+	return pins
+}
+
+// UnpinKeys forgets the keys pinned for recipient, e.g. "github:alice", so
+// they are fetched again the next time it is used. Accounts encrypted to the
+// old keys are not changed.
+func (s *Store) UnpinKeys(recipient string) error {
+	return s.update(func() error {
+		if _, ok := s.header.Settings.PinnedKeys[recipient]; !ok {
+			return fmt.Errorf("No keys are pinned for %s.", recipient)
+		}
+		delete(s.header.Settings.PinnedKeys, recipient)
+		return nil
+	})
+}
+
+// keyServerRecipients returns the recipients of "github:<user>", fetching and
+// pinning its keys the first time.
+func (s *Store) keyServerRecipients(user string) ([]age.Recipient, error) {
+	if !keyServerUserPattern.MatchString(user) {
+		return nil, fmt.Errorf("Invalid user name %q.", user)
+	}
+	name := "github:" + user
+
+	s.mu.RLock()
+	pin, ok := s.header.Settings.PinnedKeys[name]
+	s.mu.RUnlock()
+	if !ok {
+		u := s.KeyServer() + "/" + url.PathEscape(user) + ".keys"
+		keys, err := fetchKeys(u)
+		if err != nil {
+			return nil, err
+		}
+		pin = &PinnedKeys{URL: u, Keys: keys, FetchedAt: time.Now().UTC()}
+		err = s.update(func() error {
+			if s.header.Settings.PinnedKeys == nil {
+				s.header.Settings.PinnedKeys = map[string]*PinnedKeys{}
+			}
+			s.header.Settings.PinnedKeys[name] = pin
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var recipients []age.Recipient
+	for _, key := range pin.Keys {
+		r, err := parseRecipient(key)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// fetchKeys returns the supported SSH keys listed at u, one per line.
+// Unsupported key types are skipped.
+func fetchKeys(u string) ([]string, error) {
+	if err := checkKeyServer(u); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: keyServerTimeout}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch keys: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not fetch keys from %s: %s", u, resp.Status)
+	}
+
+	const keysSizeLimit = 1 << 20 // 1 MiB
+	var keys []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, keysSizeLimit))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		t, ok := sshKeyType(line)
+		if !ok || (t != "ssh-ed25519" && t != "ssh-rsa") {
+			continue
+		}
+		if _, err := parseRecipient(line); err != nil {
+			continue
+		}
+		key := normalizeRecipient(line)
+		if indexOf(keys, key) < 0 {
+			keys = append(keys, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read keys from %s: %v", u, err)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("Key server lists no supported SSH keys (ssh-ed25519, ssh-rsa) for the user.")
+	}
+	return keys, nil
+}
@@ -0,0 +1,66 @@
+package nknwallet
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultLockTimeout is the time a Store waits for the lock of a wallet file
+// held by another process when no other value is set with WithLockTimeout.
+const DefaultLockTimeout = 10 * time.Second
+
+// StaleLockAge is the age after which a lock file that is not backed by an
+// operating system lock is considered abandoned and removed.
+const StaleLockAge = 10 * time.Minute
+
+const lockRetryInterval = 50 * time.Millisecond
+
+// LockTimeoutError is returned when the lock of a wallet file could not be
+// acquired within the configured timeout.
+type LockTimeoutError struct {
+	Path  string
+	Owner string
+}
+
+func (e LockTimeoutError) Error() string {
+	if len(e.Owner) == 0 {
+		return fmt.Sprintf("Timed out waiting for lock on %q.", e.Path)
+	}
+	return fmt.Sprintf("Timed out waiting for lock on %q held by %s.", e.Path, e.Owner)
+}
+
+// lockOwner describes the current process for diagnostics in the lock file.
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("pid %d on %s since %s", os.Getpid(), host, time.Now().UTC().Format(time.RFC3339))
+}
+
+func readLockOwner(path string) string {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(dat))
+}
+
+// acquireLock calls try until it reports success or timeout has passed. A
+// timeout of zero or less waits indefinitely. name and owner describe the lock
+// in the returned LockTimeoutError.
+func acquireLock(name string, timeout time.Duration, try func() (bool, error), owner func() string) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if timeout > 0 && time.Now().After(deadline) {
+			return LockTimeoutError{Path: name, Owner: owner()}
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package nknwallet
+
+import (
+	"os"
+	"time"
+)
+
+// fileLock is a lock file created exclusively on platforms without flock(2).
+// Shared locks are exclusive here. A lock file older than StaleLockAge is
+// considered left behind by a crashed process and is removed.
+type fileLock struct {
+	path string
+}
+
+func lockFile(path string, exclusive bool, timeout time.Duration) (*fileLock, error) {
+	err := acquireLock(path, timeout, func() (bool, error) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.WriteString(lockOwner())
+			return true, f.Close()
+		}
+		if !os.IsExist(err) {
+			return false, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > StaleLockAge {
+			os.Remove(path)
+		}
+		return false, nil
+	}, func() string { return readLockOwner(path) })
+	if err != nil {
+		return nil, err
+	}
+	return &fileLock{path: path}, nil
+}
+
+func (l *fileLock) Unlock() error {
+	return os.Remove(l.path)
+}
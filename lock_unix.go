@@ -0,0 +1,55 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package nknwallet
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileLock is an advisory flock(2) lock on a lock file.
+// The kernel releases it when the holding process dies, so a lock file left
+// behind by a crashed process never blocks other processes.
+type fileLock struct {
+	f         *os.File
+	exclusive bool
+}
+
+func lockFile(path string, exclusive bool, timeout time.Duration) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	err = acquireLock(path, timeout, func() (bool, error) {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if errors.Is(err, syscall.EWOULDBLOCK) || errors.Is(err, syscall.EINTR) {
+			return false, nil
+		}
+		return err == nil, err
+	}, func() string { return readLockOwner(path) })
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if exclusive {
+		f.Truncate(0)
+		f.WriteAt([]byte(lockOwner()), 0)
+	}
+	return &fileLock{f: f, exclusive: exclusive}, nil
+}
+
+func (l *fileLock) Unlock() error {
+	defer l.f.Close()
+	if l.exclusive {
+		l.f.Truncate(0)
+	}
+	return syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,293 @@
+package nknwallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"filippo.io/age"
+)
+
+// ErrMetadataLocked is returned when a store with encrypted metadata is opened
+// without a MetadataKey able to decrypt it.
+var ErrMetadataLocked = errors.New("Wallet metadata is encrypted. Use an identity file or a passphrase to open it.")
+
+// Metadata key types recorded in StoreSettings.MetadataKeyType.
+const (
+	// MetadataKeyPassphrase seals the metadata with a passphrase.
+	MetadataKeyPassphrase = "passphrase"
+	// MetadataKeyRecipients seals the metadata to the recipients recorded
+	// in StoreSettings.MetadataRecipients.
+	MetadataKeyRecipients = "recipients"
+)
+
+// MetadataKey provides the age keys used for the whole-store encryption of
+// account metadata. Both functions are only called when the store actually
+// needs to decrypt or encrypt its metadata.
+//
+// The recipients are only asked for when metadata encryption is enabled. The
+// store records them and seals every later save to the recorded recipients,
+// whoever opened it. A store sealed with a passphrase is always opened with a
+// passphrase from the passphrase provider of the store, whatever MetadataKey
+// it is given.
+type MetadataKey struct {
+	// Identities returns the identities used to decrypt the metadata.
+	Identities func() ([]age.Identity, error)
+	// Recipients returns the recipients the metadata is encrypted to.
+	Recipients func() ([]age.Recipient, error)
+
+	// passphrase is set for keys of MetadataKeyByPassword.
+	passphrase bool
+}
+
+// MetadataKeyByIdentity returns a MetadataKey that decrypts with the identity
+// file and encrypts to the recipients of its identities. Passphrases of an
+// encrypted identity file are taken from pp.
+func MetadataKeyByIdentity(identity string, pp PassphraseProvider) *MetadataKey {
+	var ids []age.Identity
+	identities := func() ([]age.Identity, error) {
+		if ids != nil {
+			return ids, nil
+		}
+		var err error
+		ids, err = parseIdentitiesFile(identity, pp)
+		return ids, err
+	}
+	return &MetadataKey{
+		Identities: identities,
+		Recipients: func() ([]age.Recipient, error) {
+			ids, err := identities()
+			if err != nil {
+				return nil, err
+			}
+			return identitiesToRecipients(ids)
+		},
+	}
+}
+
+// MetadataKeyByRecipient returns a MetadataKey that encrypts to recipient. It
+// can't decrypt.
+func MetadataKeyByRecipient(recipient string) *MetadataKey {
+	return &MetadataKey{
+		Recipients: func() ([]age.Recipient, error) {
+			r, err := parseRecipient(recipient)
+			if err != nil {
+				return nil, err
+			}
+			return []age.Recipient{r}, nil
+		},
+	}
+}
+
+// MetadataKeyByRecipientFile returns a MetadataKey that encrypts to the
+// recipients listed in file. It can't decrypt.
+func MetadataKeyByRecipientFile(file string) *MetadataKey {
+	return &MetadataKey{
+		Recipients: func() ([]age.Recipient, error) {
+			return parseRecipientsFile(file)
+		},
+	}
+}
+
+// MetadataKeyByPassword returns a MetadataKey that encrypts and decrypts with
+// a passphrase from pp. The passphrase is asked for at most once.
+func MetadataKeyByPassword(pp PassphraseProvider) *MetadataKey {
+	var pass string
+	cached := func(prompt func() (string, error)) (string, error) {
+		if len(pass) > 0 {
+			return pass, nil
+		}
+		var err error
+		pass, err = prompt()
+		return pass, err
+	}
+	return &MetadataKey{
+		passphrase: true,
+		Identities: func() ([]age.Identity, error) {
+			return []age.Identity{&LazyScryptIdentity{Passphrase: func() (string, error) {
+				return cached(passphraseFunc(pp, "Enter passphrase"))
+			}}}, nil
+		},
+		Recipients: func() ([]age.Recipient, error) {
+			p, err := cached(func() (string, error) { return newPassphrase(pp) })
+			if err != nil {
+				return nil, err
+			}
+			r, err := age.NewScryptRecipient(p)
+			if err != nil {
+				return nil, err
+			}
+			return []age.Recipient{r}, nil
+		},
+	}
+}
+
+// WithMetadataKey sets the key used to decrypt and encrypt the account
+// metadata of a store with metadata encryption enabled.
+func WithMetadataKey(k *MetadataKey) StoreOption {
+	return func(s *Store) {
+		s.metadataKey = k
+	}
+}
+
+// IsMetadataEncrypted reports whether the account metadata of the store is
+// encrypted.
+func (s *Store) IsMetadataEncrypted() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.header.Settings.EncryptMetadata
+}
+
+// SetMetadataEncryption enables or disables the encryption of the whole
+// account metadata (IDs, types, addresses, aliases and armors). Enabling it
+// records the recipients of the store's MetadataKey, or that it is a
+// passphrase, and seals the metadata to them from then on. Enabling it again
+// replaces the recorded recipients. Backups of a wallet file holding the
+// metadata in plaintext are overwritten and removed.
+func (s *Store) SetMetadataEncryption(enabled bool) error {
+	if !enabled {
+		return s.update(func() error {
+			s.header.Settings.EncryptMetadata = false
+			s.header.Settings.MetadataKeyType = ""
+			s.header.Settings.MetadataRecipients = nil
+			return nil
+		})
+	}
+
+	if s.metadataKey == nil || s.metadataKey.Recipients == nil {
+		return errors.New("Need recipients to encrypt the wallet metadata.")
+	}
+	typ, names, err := s.metadataKeyRecord(s.metadataKey)
+	if err != nil {
+		return err
+	}
+	return s.update(func() error {
+		s.header.Settings.EncryptMetadata = true
+		s.header.Settings.MetadataKeyType = typ
+		s.header.Settings.MetadataRecipients = names
+		return nil
+	})
+}
+
+// metadataKeyRecord returns the key type and recipients to record for k.
+func (s *Store) metadataKeyRecord(k *MetadataKey) (string, []string, error) {
+	if k.passphrase {
+		return MetadataKeyPassphrase, nil, nil
+	}
+	recipients, err := k.Recipients()
+	if err != nil {
+		return "", nil, err
+	}
+	if isScrypt(recipients) {
+		return MetadataKeyPassphrase, nil, nil
+	}
+	names, err := RecipientNames(recipients)
+	if err != nil {
+		return "", nil, fmt.Errorf("Can't record the recipients of the wallet metadata: %v", err)
+	}
+	return MetadataKeyRecipients, names, nil
+}
+
+// passphraseMetadataKey returns the key of a store sealed with a passphrase:
+// the store's MetadataKey if it is a passphrase, or else one asking the
+// passphrase provider of the store. The caller must hold s.mu.
+func (s *Store) passphraseMetadataKey() *MetadataKey {
+	if s.metadataKey != nil && s.metadataKey.passphrase {
+		return s.metadataKey
+	}
+	if s.metadataPassphraseKey == nil {
+		s.metadataPassphraseKey = MetadataKeyByPassword(s.PassphraseProvider())
+	}
+	return s.metadataPassphraseKey
+}
+
+// sealRecipients returns the recipients the metadata is sealed to. The
+// caller must hold s.mu.
+func (s *Store) sealRecipients() ([]age.Recipient, error) {
+	settings := &s.header.Settings
+	switch settings.MetadataKeyType {
+	case MetadataKeyPassphrase:
+		return s.passphraseMetadataKey().Recipients()
+	case MetadataKeyRecipients:
+		var recipients []age.Recipient
+		for _, name := range settings.MetadataRecipients {
+			r, err := parseRecipient(name)
+			if err != nil {
+				return nil, fmt.Errorf("metadata recipient %q: %v", name, err)
+			}
+			recipients = append(recipients, r)
+		}
+		if len(recipients) == 0 {
+			return nil, errors.New("Wallet metadata has no recipients.")
+		}
+		return recipients, nil
+	}
+
+	// Metadata sealed before its key was recorded is sealed to the store's
+	// MetadataKey once more, which is recorded from then on.
+	if s.metadataKey == nil || s.metadataKey.Recipients == nil {
+		return nil, errors.New("Need recipients to encrypt the wallet metadata.")
+	}
+	recipients, err := s.metadataKey.Recipients()
+	if err != nil {
+		return nil, err
+	}
+	if typ, names, err := s.metadataKeyRecord(s.metadataKey); err == nil {
+		settings.MetadataKeyType, settings.MetadataRecipients = typ, names
+	}
+	return recipients, nil
+}
+
+// sealAccounts encrypts the JSON encoded accounts to the recorded metadata
+// recipients. The caller must hold s.mu.
+func (s *Store) sealAccounts(accounts []*Wallet) (string, error) {
+	recipients, err := s.sealRecipients()
+	if err != nil {
+		return "", err
+	}
+
+	dat, err := json.Marshal(accounts)
+	if err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	if err := encrypt(recipients, bytes.NewReader(dat), out); err != nil {
+		return "", err
+	}
+	s.sealed, s.unsealed = out.String(), dat
+	return s.sealed, nil
+}
+
+// unsealAccounts decrypts accounts sealed by sealAccounts with the key of the
+// recorded key type of settings. The plaintext of the last sealed or unsealed
+// armor is cached, so reloading an unchanged store does not decrypt again.
+// The caller must hold s.mu.
+func (s *Store) unsealAccounts(sealed string, settings StoreSettings) ([]*Wallet, error) {
+	dat := s.unsealed
+	if sealed != s.sealed {
+		key := s.metadataKey
+		if settings.MetadataKeyType == MetadataKeyPassphrase {
+			key = s.passphraseMetadataKey()
+		}
+		if key == nil || key.Identities == nil {
+			return nil, ErrMetadataLocked
+		}
+		identities, err := key.Identities()
+		if err != nil {
+			return nil, err
+		}
+		out := &bytes.Buffer{}
+		if err := decrypt(identities, bytes.NewBufferString(sealed), out); err != nil {
+			return nil, err
+		}
+		dat = out.Bytes()
+		s.sealed, s.unsealed = sealed, dat
+	}
+
+	var accounts []*Wallet
+	if err := json.Unmarshal(dat, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
@@ -0,0 +1,146 @@
+package nknwallet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func writeIdentity(t *testing.T, dir, name string) (string, *age.X25519Identity) {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, id
+}
+
+func TestMetadataSealedToRecordedRecipients(t *testing.T) {
+	dir := t.TempDir()
+	alice, aliceID := writeIdentity(t, dir, "alice.txt")
+	bob, bobID := writeIdentity(t, dir, "bob.txt")
+	team := filepath.Join(dir, "team.txt")
+	if err := os.WriteFile(team, []byte(aliceID.Recipient().String()+"\n"+bobID.Recipient().String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b := NewMemBackend()
+
+	s, err := NewStore("", WithBackend(b), WithMetadataKey(MetadataKeyByRecipientFile(team)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMetadataEncryption(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// alice saves with her own identity, bob must still be able to open it
+	s, err = NewStore("", WithBackend(b), WithMetadataKey(MetadataKeyByIdentity(alice, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddWatch("NKNTvYoLtzvoQU5wftsAmEovBQQ54Gqi8HUT", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewStore("", WithBackend(b), WithMetadataKey(MetadataKeyByIdentity(bob, nil)))
+	if err != nil {
+		t.Fatalf("bob can't open the metadata saved by alice: %v", err)
+	}
+	if len(s.GetWallets()) != 1 {
+		t.Fatalf("store has %d accounts, want 1", len(s.GetWallets()))
+	}
+
+	if _, err := NewStore("", WithBackend(b)); !errors.Is(err, ErrMetadataLocked) {
+		t.Fatalf("NewStore without metadata key = %v, want ErrMetadataLocked", err)
+	}
+}
+
+func TestMetadataSealedWithPassphraseIgnoresIdentity(t *testing.T) {
+	alice, _ := writeIdentity(t, t.TempDir(), "alice.txt")
+	pp := staticPassphrase("metadata passphrase")
+	b := NewMemBackend()
+
+	s, err := NewStore("", WithBackend(b), WithPassphraseProvider(pp), WithMetadataKey(MetadataKeyByPassword(pp)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMetadataEncryption(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddWatch("NKNTvYoLtzvoQU5wftsAmEovBQQ54Gqi8HUT", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewStore("", WithBackend(b), WithPassphraseProvider(pp), WithMetadataKey(MetadataKeyByIdentity(alice, pp)))
+	if err != nil {
+		t.Fatalf("passphrase sealed store can't be opened with an identity file given: %v", err)
+	}
+	if _, err := s.AddWatch("NKNY1DjDmHc9Ejq3KMXychfYiEkN9A9PG4kj", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewStore("", WithBackend(b), WithPassphraseProvider(pp))
+	if err != nil {
+		t.Fatalf("store resealed with the identity of an account: %v", err)
+	}
+	if len(s.GetWallets()) != 2 {
+		t.Fatalf("store has %d accounts, want 2", len(s.GetWallets()))
+	}
+}
+
+func TestMetadataEncryptionLeavesNoPlaintextBackups(t *testing.T) {
+	dir := t.TempDir()
+	identity, _ := writeIdentity(t, dir, "key.txt")
+	path := filepath.Join(dir, "wallet.json")
+	const address = "NKNTvYoLtzvoQU5wftsAmEovBQQ54Gqi8HUT"
+
+	s, err := NewStore(path, WithMetadataKey(MetadataKeyByIdentity(identity, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddWatch(address, nil, "secret alias"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddWatch("NKNY1DjDmHc9Ejq3KMXychfYiEkN9A9PG4kj", nil, "other alias"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bak.1"); err != nil {
+		t.Fatalf("no plaintext backup before enabling: %v", err)
+	}
+	if err := s.SetMetadataEncryption(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteWalletByIndex(2); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backups := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, ".lock") {
+			continue
+		}
+		if strings.Contains(file, ".bak.") {
+			backups++
+		}
+		dat, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(dat), address) || strings.Contains(string(dat), "alias") {
+			t.Fatalf("%s holds plaintext metadata: %s", file, dat)
+		}
+	}
+	if backups != 1 {
+		t.Fatalf("found %d backups, want the sealed one written after enabling", backups)
+	}
+}
@@ -0,0 +1,135 @@
+package nknwallet
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var (
+	wordIndexOnce sync.Once
+	wordIndex     map[string]int
+)
+
+// lookupWord returns the index of word in the BIP39 english wordlist. word may
+// be abbreviated to any prefix that matches a single word, e.g. the first four
+// letters.
+func lookupWord(word string) (int, error) {
+	wordIndexOnce.Do(func() {
+		wordIndex = make(map[string]int, len(wordlist))
+		for i, w := range wordlist {
+			wordIndex[w] = i
+		}
+	})
+
+	word = strings.ToLower(word)
+	if i, ok := wordIndex[word]; ok {
+		return i, nil
+	}
+	var matches []string
+	for _, w := range wordlist {
+		if strings.HasPrefix(w, word) {
+			matches = append(matches, w)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("%q is not a BIP39 word", word)
+	case 1:
+		return wordIndex[matches[0]], nil
+	}
+	return 0, fmt.Errorf("%q is ambiguous: %s", word, strings.Join(matches, ", "))
+}
+
+// checksumBits returns the first n bits of the SHA-256 hash of entropy.
+func checksumBits(entropy []byte, n int) *big.Int {
+	hash := sha256.Sum256(entropy)
+	cs := new(big.Int)
+	for i := 0; i < n; i++ {
+		bit := (hash[i/8] >> (7 - uint(i%8))) & 1
+		cs.Lsh(cs, 1)
+		cs.Or(cs, big.NewInt(int64(bit)))
+	}
+	return cs
+}
+
+// entropyToWords encodes entropy as BIP39 words: the entropy followed by the
+// first len(entropy)*8/32 bits of its SHA-256 hash as checksum, in groups of
+// 11 bits.
+func entropyToWords(entropy []byte) ([]string, error) {
+	if len(entropy) == 0 || len(entropy)%4 != 0 {
+		return nil, errors.New("entropy length must be a multiple of 4 bytes")
+	}
+	csBits := len(entropy) * 8 / 32
+
+	n := new(big.Int).SetBytes(entropy)
+	n.Lsh(n, uint(csBits))
+	n.Or(n, checksumBits(entropy, csBits))
+
+	count := (len(entropy)*8 + csBits) / 11
+	words := make([]string, count)
+	mask := big.NewInt(2047)
+	for i := count - 1; i >= 0; i-- {
+		words[i] = wordlist[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 11)
+	}
+	return words, nil
+}
+
+// wordsToEntropy decodes words encoded by entropyToWords and verifies their
+// checksum.
+func wordsToEntropy(words []string) ([]byte, error) {
+	if len(words) == 0 || len(words)%3 != 0 {
+		return nil, errors.New("number of words must be a multiple of 3")
+	}
+
+	n := new(big.Int)
+	for _, word := range words {
+		i, err := lookupWord(word)
+		if err != nil {
+			return nil, err
+		}
+		n.Lsh(n, 11)
+		n.Or(n, big.NewInt(int64(i)))
+	}
+
+	csBits := len(words) * 11 / 33
+	entBits := len(words)*11 - csBits
+
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(csBits)), big.NewInt(1))
+	checksum := new(big.Int).And(n, mask)
+	n.Rsh(n, uint(csBits))
+	entropy := n.FillBytes(make([]byte, entBits/8))
+
+	if checksum.Cmp(checksumBits(entropy, csBits)) != 0 {
+		return nil, errors.New("Invalid mnemonic checksum. Check the words and their order.")
+	}
+	return entropy, nil
+}
+
+// SeedToMnemonic encodes an account seed as BIP39 mnemonic. The seed is used
+// as BIP39 entropy, so a 32 byte seed results in 24 words.
+func SeedToMnemonic(seed []byte) (string, error) {
+	words, err := entropyToWords(seed)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToSeed decodes a mnemonic created by SeedToMnemonic and validates
+// its checksum. Words may be abbreviated to unique prefixes.
+func MnemonicToSeed(mnemonic string) ([]byte, error) {
+	return wordsToEntropy(strings.Fields(mnemonic))
+}
+
+// Mnemonic returns the seed of the wallet as BIP39 mnemonic.
+func (w *Wallet) Mnemonic() (string, error) {
+	if w.Account() == nil {
+		return "", ErrSeedUnavailable
+	}
+	return SeedToMnemonic(w.Seed())
+}
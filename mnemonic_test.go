@@ -0,0 +1,66 @@
+package nknwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMnemonicVectors(t *testing.T) {
+	// BIP39 reference vectors of the english wordlist
+	tests := []struct {
+		entropy  string
+		mnemonic string
+	}{
+		{"00000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+		{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+		{"80808080808080808080808080808080", "letter advice cage absurd amount doctor acoustic avoid letter advice cage above"},
+		{"ffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong"},
+		{"9e885d952ad362caeb4efe34a8e91bd2", "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic"},
+		{"0000000000000000000000000000000000000000000000000000000000000000", strings.Repeat("abandon ", 23) + "art"},
+		{"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", strings.Repeat("zoo ", 23) + "vote"},
+		{"68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c", "hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length"},
+	}
+	for _, tt := range tests {
+		entropy, _ := hex.DecodeString(tt.entropy)
+		mnemonic, err := SeedToMnemonic(entropy)
+		if err != nil {
+			t.Errorf("SeedToMnemonic(%s): %v", tt.entropy, err)
+			continue
+		}
+		if mnemonic != tt.mnemonic {
+			t.Errorf("SeedToMnemonic(%s) = %q, want %q", tt.entropy, mnemonic, tt.mnemonic)
+		}
+		seed, err := MnemonicToSeed(tt.mnemonic)
+		if err != nil || !bytes.Equal(seed, entropy) {
+			t.Errorf("MnemonicToSeed(%q) = %x, %v, want %s", tt.mnemonic, seed, err, tt.entropy)
+		}
+	}
+}
+
+func TestMnemonicToSeedAbbreviated(t *testing.T) {
+	entropy, _ := hex.DecodeString("68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c")
+	seed, err := MnemonicToSeed("hams diag priv dutc caus dela priv meat slid todd razo book happ fanc gosp tenn mapl dile loan word shru infl dela leng")
+	if err != nil || !bytes.Equal(seed, entropy) {
+		t.Fatalf("MnemonicToSeed of abbreviated words = %x, %v", seed, err)
+	}
+}
+
+func TestMnemonicToSeedInvalid(t *testing.T) {
+	for _, mnemonic := range []string{
+		"",
+		// wrong checksum
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		// unknown word
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon nkn",
+		// ambiguous prefix
+		"ab abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		// word count not a multiple of 3
+		"abandon abandon abandon about",
+	} {
+		if _, err := MnemonicToSeed(mnemonic); err == nil {
+			t.Errorf("MnemonicToSeed(%q) succeeded", mnemonic)
+		}
+	}
+}
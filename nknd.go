@@ -0,0 +1,60 @@
+package nknwallet
+
+import (
+	"errors"
+	"os"
+
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+// ReadNKNWallet decrypts a wallet.json file in the format of nknd and
+// nkn-sdk-go (scrypt and AES encrypted vault) with its password and returns
+// its account.
+func ReadNKNWallet(file, password string) (*nkn.Account, error) {
+	dat, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := nkn.WalletFromJSON(string(dat), &nkn.WalletConfig{Password: password})
+	if err != nil {
+		return nil, err
+	}
+	return w.Account(), nil
+}
+
+// ImportNKNWallet imports the account of a wallet.json file of nknd and
+// nkn-sdk-go decrypted with its password: the account is encrypted with key
+// by the account type typ, see RestoreFromSeed, and saved to the store.
+func (s *Store) ImportNKNWallet(file, password, typ string, key AccountKey) (*Wallet, error) {
+	account, err := ReadNKNWallet(file, password)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.RestoreFromSeed(typ, account.Seed(), key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SaveWallet(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// ExportNKNWallet returns the account of the wallet as wallet.json in the
+// format expected by nknd and nkn-sdk-go, encrypted with password. The wallet
+// must have been decrypted.
+func (w *Wallet) ExportNKNWallet(password string) ([]byte, error) {
+	if w.Account() == nil {
+		return nil, errors.New("Wallet is not decrypted.")
+	}
+	if len(password) == 0 {
+		return nil, errors.New("Need a password to export the wallet.")
+	}
+
+	nw, err := nkn.NewWallet(w.Account(), &nkn.WalletConfig{Password: password})
+	if err != nil {
+		return nil, err
+	}
+	return nw.MarshalJSON()
+}
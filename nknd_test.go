@@ -0,0 +1,68 @@
+package nknwallet
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+func writeNKNWallet(t *testing.T, dir, password string) (string, *nkn.Account) {
+	t.Helper()
+	account, err := nkn.NewAccount(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := nkn.NewWallet(account, &nkn.WalletConfig{Password: password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat, err := w.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "wallet.json")
+	if err := os.WriteFile(file, dat, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file, account
+}
+
+func TestImportNKNWallet(t *testing.T) {
+	dir := t.TempDir()
+	file, account := writeNKNWallet(t, dir, "nknd password")
+	identity, _ := writeIdentity(t, dir, "key.txt")
+
+	s, err := NewStore("", WithBackend(NewMemBackend()), WithScryptWorkFactor(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ImportNKNWallet(file, "wrong", "identity", AccountKey{Identity: identity}); err == nil {
+		t.Fatal("ImportNKNWallet with a wrong password succeeded")
+	}
+
+	w, err := s.ImportNKNWallet(file, "nknd password", "identity", AccountKey{Identity: identity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Type != "IDENTITY" || w.Address() != account.WalletAddress() {
+		t.Fatalf("imported account is %s %s, want IDENTITY %s", w.Type, w.Address(), account.WalletAddress())
+	}
+	if !s.IsExistWalletByIndex(w.ID) {
+		t.Fatal("imported account is not saved")
+	}
+
+	d, err := s.DecryptWallet(w.ID, AccountKey{Identity: identity}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.Account().Seed(), account.Seed()) {
+		t.Fatal("decrypted seed differs from the seed of the NKN wallet file")
+	}
+
+	if _, err := s.ImportNKNWallet(file, "nknd password", "scrypt", AccountKey{Passphrase: "new"}); err == nil {
+		t.Fatal("importing an account twice succeeded")
+	}
+}
@@ -0,0 +1,305 @@
+package nknwallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/nknorg/nkn-sdk-go"
+	"github.com/nknorg/nkn/v2/common"
+	nknConfig "github.com/nknorg/nkn/v2/config"
+	"github.com/nknorg/nkn/v2/transaction"
+)
+
+// Cold accounts are kept on an offline machine. Transactions for them are
+// built online (BuildTx, NewOfflineTx), carried to the offline machine in an
+// offline transaction file and signed there (OfflineTx.Sign), then carried
+// back and broadcast online (OfflineTx.Broadcast).
+//
+// The file names its format and version and holds the unsigned transaction,
+// its summary and hash, the signed transaction once signed, and a checksum of
+// all of it. Every step checks the file: the checksum catches accidental
+// changes, the summary must match the transaction it describes, the signed
+// transaction must be the unsigned one and carry a valid signature. What is
+// shown and signed is always decoded from the transaction itself.
+
+// OfflineTxFormat names the offline transaction file format.
+const OfflineTxFormat = "nkn-wallet-offline-tx"
+
+// OfflineTxVersion is the version of the offline transaction file format.
+const OfflineTxVersion = 1
+
+// TxParams are the parameters of a transaction built by BuildTx. Each kind
+// uses the ones it needs.
+type TxParams struct {
+	// Sender is the address of the account sending the transaction.
+	Sender string
+	// PubKey is the public key of the sender, needed by every kind but
+	// transfers.
+	PubKey []byte
+	// Recipient is the address of a transfer.
+	Recipient string
+	// RecipientPubKey is the public key a name is transferred to.
+	RecipientPubKey []byte
+	Amount          string
+	Fee             string
+	Nonce           uint64
+	Name            string
+	Topic           string
+	Identifier      string
+	Duration        uint32
+	Meta            string
+}
+
+// BuildTx returns the unsigned transaction of kind, one of TxTransfer,
+// TxRegisterName, TxTransferName, TxDeleteName, TxSubscribe and TxUnsubscribe.
+func BuildTx(kind string, p TxParams) (*transaction.Transaction, error) {
+	sender, err := common.ToScriptHash(p.Sender)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid sender address %s.", p.Sender)
+	}
+	if kind != TxTransfer {
+		if len(p.PubKey) == 0 {
+			return nil, errors.New("Public key of the sender is needed.")
+		}
+		if a, err := pubKeyToAddress(p.PubKey); err != nil || a != p.Sender {
+			return nil, fmt.Errorf("Public key does not belong to %s.", p.Sender)
+		}
+	}
+	fee := common.Fixed64(0)
+	if len(p.Fee) > 0 {
+		if fee, err = common.StringToFixed64(p.Fee); err != nil {
+			return nil, fmt.Errorf("Invalid fee %s.", p.Fee)
+		}
+	}
+
+	switch kind {
+	case TxTransfer:
+		recipient, err := common.ToScriptHash(p.Recipient)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid recipient address %s.", p.Recipient)
+		}
+		amount, err := common.StringToFixed64(p.Amount)
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("Invalid amount %s.", p.Amount)
+		}
+		return transaction.NewTransferAssetTransaction(sender, recipient, p.Nonce, amount, fee)
+	case TxRegisterName:
+		return transaction.NewRegisterNameTransaction(p.PubKey, p.Name, p.Nonce, nknConfig.MinNameRegistrationFee, fee)
+	case TxTransferName:
+		if len(p.RecipientPubKey) == 0 {
+			return nil, errors.New("Public key of the recipient is needed.")
+		}
+		return transaction.NewTransferNameTransaction(p.PubKey, p.RecipientPubKey, p.Name, p.Nonce, fee)
+	case TxDeleteName:
+		return transaction.NewDeleteNameTransaction(p.PubKey, p.Name, p.Nonce, fee)
+	case TxSubscribe:
+		return transaction.NewSubscribeTransaction(p.PubKey, p.Identifier, p.Topic, p.Duration, p.Meta, p.Nonce, fee)
+	case TxUnsubscribe:
+		return transaction.NewUnsubscribeTransaction(p.PubKey, p.Identifier, p.Topic, p.Nonce, fee)
+	}
+	return nil, fmt.Errorf("Unknown transaction kind %s.", kind)
+}
+
+// OfflineTx is an offline transaction file.
+type OfflineTx struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Summary describes Tx for humans.
+	Summary *TxSummary `json:"summary"`
+	// Hash is the hash of the transaction, its ID once broadcast.
+	Hash string `json:"hash"`
+	// Tx is the hex encoded unsigned transaction.
+	Tx string `json:"tx"`
+	// SignedTx is the hex encoded signed transaction, once signed.
+	SignedTx string     `json:"signed_tx,omitempty"`
+	SignedAt *time.Time `json:"signed_at,omitempty"`
+	// Checksum is the SHA-256 of the file without it.
+	Checksum string `json:"checksum"`
+}
+
+// NewOfflineTx returns the offline transaction file of the unsigned tx.
+func NewOfflineTx(tx *transaction.Transaction) (*OfflineTx, error) {
+	summary, err := SummarizeTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	dat, err := tx.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	hash := tx.Hash()
+	ftx := &OfflineTx{
+		Format:    OfflineTxFormat,
+		Version:   OfflineTxVersion,
+		CreatedAt: time.Now().UTC(),
+		Summary:   summary,
+		Hash:      hash.ToHexString(),
+		Tx:        hex.EncodeToString(dat),
+	}
+	if ftx.Checksum, err = ftx.checksum(); err != nil {
+		return nil, err
+	}
+	return ftx, nil
+}
+
+// ReadOfflineTx reads and verifies the offline transaction file path.
+func ReadOfflineTx(path string) (*OfflineTx, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ftx := &OfflineTx{}
+	if err := json.Unmarshal(dat, ftx); err != nil {
+		return nil, fmt.Errorf("%s is not an offline transaction file: %v", path, err)
+	}
+	if err := ftx.Verify(); err != nil {
+		return nil, err
+	}
+	return ftx, nil
+}
+
+// Write writes the offline transaction file to path.
+func (ftx *OfflineTx) Write(path string) error {
+	dat, err := json.MarshalIndent(ftx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(dat, '\n'), 0600)
+}
+
+func (ftx *OfflineTx) checksum() (string, error) {
+	c := *ftx
+	c.Checksum = ""
+	dat, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(dat)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks that the file is intact: its checksum, that the summary and
+// hash match the transaction and, if it is signed, that the signed
+// transaction is the same transaction with a valid signature.
+func (ftx *OfflineTx) Verify() error {
+	if ftx.Format != OfflineTxFormat {
+		return errors.New("File is not an offline transaction file.")
+	}
+	if ftx.Version != OfflineTxVersion {
+		return fmt.Errorf("Unsupported offline transaction file version %d.", ftx.Version)
+	}
+	if sum, err := ftx.checksum(); err != nil || sum != ftx.Checksum {
+		return errors.New("Checksum of the offline transaction file does not match. It was changed or damaged.")
+	}
+	tx, err := ftx.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	if hash := tx.Hash(); hash.ToHexString() != ftx.Hash {
+		return errors.New("Hash does not match the transaction. The file was tampered with.")
+	}
+	summary, err := SummarizeTx(tx)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(summary, ftx.Summary) {
+		return errors.New("Summary does not match the transaction. The file was tampered with.")
+	}
+	if len(tx.Programs) > 0 {
+		return errors.New("Unsigned transaction carries signatures.")
+	}
+
+	if len(ftx.SignedTx) == 0 {
+		return nil
+	}
+	signed, err := decodeTx(ftx.SignedTx)
+	if err != nil {
+		return err
+	}
+	if hash := signed.Hash(); hash.ToHexString() != ftx.Hash {
+		return errors.New("Signed transaction is not the unsigned one. The file was tampered with.")
+	}
+	if err := signed.VerifySignature(); err != nil {
+		return fmt.Errorf("Signature of the transaction is invalid: %v", err)
+	}
+	return nil
+}
+
+// UnsignedTx returns the unsigned transaction.
+func (ftx *OfflineTx) UnsignedTx() (*transaction.Transaction, error) {
+	return decodeTx(ftx.Tx)
+}
+
+// Signed reports whether the transaction is signed.
+func (ftx *OfflineTx) Signed() bool {
+	return len(ftx.SignedTx) > 0
+}
+
+// Sign signs the transaction with w, which must be its sender.
+func (ftx *OfflineTx) Sign(w *Wallet) error {
+	if err := ftx.Verify(); err != nil {
+		return err
+	}
+	if w.Address() != ftx.Summary.Sender {
+		return fmt.Errorf("Transaction is sent by %s, not by account %d (%s).", ftx.Summary.Sender, w.ID, w.Address())
+	}
+	tx, err := ftx.UnsignedTx()
+	if err != nil {
+		return err
+	}
+	if err := w.SignTransaction(tx); err != nil {
+		return err
+	}
+	if err := tx.VerifySignature(); err != nil {
+		return fmt.Errorf("Signature of the transaction is invalid: %v", err)
+	}
+	dat, err := tx.Marshal()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	ftx.SignedTx = hex.EncodeToString(dat)
+	ftx.SignedAt = &now
+	ftx.Checksum, err = ftx.checksum()
+	return err
+}
+
+// Broadcast verifies the signed transaction and sends it to the NKN network.
+// It returns the transaction hash.
+func (ftx *OfflineTx) Broadcast(ctx context.Context, config *nkn.WalletConfig) (string, error) {
+	if err := ftx.Verify(); err != nil {
+		return "", err
+	}
+	if !ftx.Signed() {
+		return "", errors.New("Transaction is not signed yet.")
+	}
+	tx, err := decodeTx(ftx.SignedTx)
+	if err != nil {
+		return "", err
+	}
+	config, err = nkn.MergeWalletConfig(config)
+	if err != nil {
+		return "", err
+	}
+	return nkn.SendRawTransactionContext(ctx, tx, config)
+}
+
+func decodeTx(s string) (*transaction.Transaction, error) {
+	dat, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("Transaction is not hex encoded.")
+	}
+	tx := &transaction.Transaction{}
+	if err := tx.Unmarshal(dat); err != nil {
+		return nil, fmt.Errorf("Invalid transaction: %v", err)
+	}
+	return tx, nil
+}
@@ -0,0 +1,235 @@
+package nknwallet
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nknorg/nkn-sdk-go"
+	"github.com/nknorg/nkn/v2/transaction"
+)
+
+// testAccount returns a new decrypted account of a store in memory.
+func testAccount(t *testing.T) *Wallet {
+	t.Helper()
+	s, err := NewStore("", WithBackend(NewMemBackend()), WithScryptWorkFactor(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := s.NewWallet("scrypt", AccountKey{Passphrase: "test"}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func testOfflineTx(t *testing.T, sender *Wallet, nonce uint64) *OfflineTx {
+	t.Helper()
+	recipient, err := nkn.NewAccount(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := BuildTx(TxTransfer, TxParams{Sender: sender.Address(), Recipient: recipient.WalletAddress(), Amount: "1.5", Fee: "0.1", Nonce: nonce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ftx, err := NewOfflineTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ftx
+}
+
+// resum recomputes the checksum of ftx, as someone tampering with the file
+// would.
+func resum(t *testing.T, ftx *OfflineTx) {
+	t.Helper()
+	var err error
+	if ftx.Checksum, err = ftx.checksum(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signedTxHex(t *testing.T, w *Wallet, tx *transaction.Transaction) string {
+	t.Helper()
+	if err := w.SignTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	dat, err := tx.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(dat)
+}
+
+func TestOfflineTxRoundTrip(t *testing.T) {
+	sender := testAccount(t)
+	recipient := testAccount(t)
+	params := TxParams{
+		Sender:          sender.Address(),
+		PubKey:          sender.PubKey(),
+		Recipient:       recipient.Address(),
+		RecipientPubKey: recipient.PubKey(),
+		Amount:          "2",
+		Fee:             "0.01",
+		Nonce:           7,
+		Name:            "somename",
+		Topic:           "news",
+		Identifier:      "client",
+		Duration:        100,
+		Meta:            "meta",
+	}
+	path := filepath.Join(t.TempDir(), "tx.json")
+
+	for _, kind := range []string{TxTransfer, TxRegisterName, TxTransferName, TxDeleteName, TxSubscribe, TxUnsubscribe} {
+		t.Run(kind, func(t *testing.T) {
+			tx, err := BuildTx(kind, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ftx, err := NewOfflineTx(tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ftx.Summary.Kind != kind || ftx.Summary.Nonce != params.Nonce {
+				t.Fatalf("summary is %s with nonce %d, want %s with nonce %d", ftx.Summary.Kind, ftx.Summary.Nonce, kind, params.Nonce)
+			}
+			if err := ftx.Write(path); err != nil {
+				t.Fatal(err)
+			}
+
+			// offline
+			ftx, err = ReadOfflineTx(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ftx.Sign(sender); err != nil {
+				t.Fatal(err)
+			}
+			if err := ftx.Write(path); err != nil {
+				t.Fatal(err)
+			}
+
+			// online
+			ftx, err = ReadOfflineTx(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ftx.Signed() {
+				t.Fatal("signed transaction file is not signed")
+			}
+			signed, err := decodeTx(ftx.SignedTx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := signed.VerifySignature(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOfflineTxTampering(t *testing.T) {
+	sender := testAccount(t)
+	other := testAccount(t)
+
+	tests := []struct {
+		name   string
+		tamper func(ftx *OfflineTx)
+		err    string
+	}{
+		{
+			name:   "changed amount",
+			tamper: func(ftx *OfflineTx) { ftx.Summary.Amount = "1000" },
+			err:    "Checksum",
+		},
+		{
+			name: "changed summary with checksum",
+			tamper: func(ftx *OfflineTx) {
+				ftx.Summary.Amount = "1000"
+				resum(t, ftx)
+			},
+			err: "Summary does not match",
+		},
+		{
+			name: "other signed transaction",
+			tamper: func(ftx *OfflineTx) {
+				tx, err := testOfflineTx(t, sender, 2).UnsignedTx()
+				if err != nil {
+					t.Fatal(err)
+				}
+				ftx.SignedTx = signedTxHex(t, sender, tx)
+				resum(t, ftx)
+			},
+			err: "Signed transaction is not the unsigned one",
+		},
+		{
+			name: "signature of another key",
+			tamper: func(ftx *OfflineTx) {
+				tx, err := ftx.UnsignedTx()
+				if err != nil {
+					t.Fatal(err)
+				}
+				ftx.SignedTx = signedTxHex(t, other, tx)
+				resum(t, ftx)
+			},
+			err: "Signature of the transaction is invalid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ftx := testOfflineTx(t, sender, 1)
+			if err := ftx.Sign(sender); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(ftx)
+			path := filepath.Join(t.TempDir(), "tx.json")
+			if err := ftx.Write(path); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadOfflineTx(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("ReadOfflineTx of a tampered file = %v, want %q", err, tt.err)
+			}
+			if err := ftx.Sign(sender); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Sign of a tampered file = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestOfflineTxEditedFile(t *testing.T) {
+	sender := testAccount(t)
+	ftx := testOfflineTx(t, sender, 1)
+	path := filepath.Join(t.TempDir(), "tx.json")
+	if err := ftx.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(dat), `"amount": "1.50000000"`, `"amount": "15.00000000"`, 1)
+	if edited == string(dat) {
+		t.Fatalf("amount not found in %s", dat)
+	}
+	if err := os.WriteFile(path, []byte(edited), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadOfflineTx(path); err == nil || !strings.Contains(err.Error(), "Checksum") {
+		t.Fatalf("ReadOfflineTx of an edited file = %v, want a checksum error", err)
+	}
+}
+
+func TestOfflineTxSignByOtherAccount(t *testing.T) {
+	sender := testAccount(t)
+	ftx := testOfflineTx(t, sender, 1)
+	if err := ftx.Sign(testAccount(t)); err == nil {
+		t.Fatal("Sign by an account which is not the sender succeeded")
+	}
+	if ftx.Signed() {
+		t.Fatal("transaction was signed by an account which is not the sender")
+	}
+}
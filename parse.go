@@ -15,7 +15,7 @@ import (
 	"filippo.io/age"
 	"filippo.io/age/agessh"
 	"filippo.io/age/armor"
-	"github.com/nknorg/nkn/v2/util/password"
+	"github.com/omani/nkn-wallet/internal/plugin"
 	"golang.org/x/crypto/cryptobyte"
 	"golang.org/x/crypto/ssh"
 )
@@ -25,15 +25,25 @@ type gitHubRecipientError struct {
 }
 
 func (gitHubRecipientError) Error() string {
-	return `"github:" recipients were removed from the design`
+	return `"github:" recipients are only supported by Store.ParseRecipient, which fetches and pins their keys`
 }
 
 func parseRecipient(arg string) (age.Recipient, error) {
 	switch {
+	case isPluginRecipient(arg):
+		r, err := plugin.NewRecipient(arg, pluginUI(nil))
+		if err != nil {
+			return nil, err
+		}
+		return &namedRecipient{r, arg}, nil
 	case strings.HasPrefix(arg, "age1"):
 		return age.ParseX25519Recipient(arg)
 	case strings.HasPrefix(arg, "ssh-"):
-		return agessh.ParseRecipient(arg)
+		r, err := agessh.ParseRecipient(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &namedRecipient{r, normalizeRecipient(arg)}, nil
 	case strings.HasPrefix(arg, "github:"):
 		name := strings.TrimPrefix(arg, "github:")
 		return nil, gitHubRecipientError{name}
@@ -113,7 +123,7 @@ func sshKeyType(s string) (string, bool) {
 // parseIdentitiesFile parses a file that contains age or SSH keys. It returns
 // one or more of *age.X25519Identity, *agessh.RSAIdentity, *agessh.Ed25519Identity,
 // *agessh.EncryptedSSHIdentity, or *EncryptedIdentity.
-func parseIdentitiesFile(name string) ([]age.Identity, error) {
+func parseIdentitiesFile(name string, pp PassphraseProvider) ([]age.Identity, error) {
 	var f *os.File
 	var err error
 	f, err = os.Open(name)
@@ -142,14 +152,8 @@ func parseIdentitiesFile(name string) ([]age.Identity, error) {
 			return nil, fmt.Errorf("failed to read %q: file too long", name)
 		}
 		return []age.Identity{&EncryptedIdentity{
-			Contents: contents,
-			Passphrase: func() (string, error) {
-				pass, err := password.GetPassword(fmt.Sprintf("Enter passphrase for identity file %q", name))
-				if err != nil {
-					return "", fmt.Errorf("could not read passphrase: %v", err)
-				}
-				return string(pass), nil
-			},
+			Contents:   contents,
+			Passphrase: passphraseFunc(pp, fmt.Sprintf("Enter passphrase for identity file %q", name)),
 			NoMatchWarning: func() {
 				fmt.Printf("encrypted identity file %q didn't match file's recipients", name)
 			},
@@ -165,11 +169,11 @@ func parseIdentitiesFile(name string) ([]age.Identity, error) {
 		if len(contents) == privateKeySizeLimit {
 			return nil, fmt.Errorf("failed to read %q: file too long", name)
 		}
-		return parseSSHIdentity(name, contents)
+		return parseSSHIdentity(name, contents, pp)
 
 	// An unencrypted age identity file.
 	default:
-		ids, err := age.ParseIdentities(b)
+		ids, err := parseIdentities(b, pp)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read %q: %v", name, err)
 		}
@@ -177,7 +181,47 @@ func parseIdentitiesFile(name string) ([]age.Identity, error) {
 	}
 }
 
-func parseSSHIdentity(name string, pemBytes []byte) ([]age.Identity, error) {
+func parseIdentity(s string, pp PassphraseProvider) (age.Identity, error) {
+	switch {
+	case strings.HasPrefix(s, "AGE-PLUGIN-"):
+		return plugin.NewIdentity(s, pluginUI(pp))
+	case strings.HasPrefix(s, "AGE-SECRET-KEY-1"):
+		return age.ParseX25519Identity(s)
+	default:
+		return nil, fmt.Errorf("unknown identity type")
+	}
+}
+
+// parseIdentities is like age.ParseIdentities, but supports plugin identities.
+func parseIdentities(f io.Reader, pp PassphraseProvider) ([]age.Identity, error) {
+	const privateKeySizeLimit = 1 << 24 // 16 MiB
+	var ids []age.Identity
+	scanner := bufio.NewScanner(io.LimitReader(f, privateKeySizeLimit))
+	var n int
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+
+		i, err := parseIdentity(line, pp)
+		if err != nil {
+			return nil, fmt.Errorf("error at line %d: %v", n, err)
+		}
+		ids = append(ids, i)
+
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read secret keys file: %v", err)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no secret keys found")
+	}
+	return ids, nil
+}
+
+func parseSSHIdentity(name string, pemBytes []byte, pp PassphraseProvider) ([]age.Identity, error) {
 	id, err := agessh.ParseIdentity(pemBytes)
 	if sshErr, ok := err.(*ssh.PassphraseMissingError); ok {
 		pubKey := sshErr.PublicKey
@@ -188,22 +232,25 @@ func parseSSHIdentity(name string, pemBytes []byte) ([]age.Identity, error) {
 			}
 		}
 		passphrasePrompt := func() ([]byte, error) {
-			pass, err := password.GetPassword(fmt.Sprintf("Enter passphrase for %q", name))
+			pass, err := pp.Passphrase(PassphraseRequest{Prompt: fmt.Sprintf("Enter passphrase for %q", name)})
 			if err != nil {
 				return nil, fmt.Errorf("could not read passphrase for %q: %v", name, err)
 			}
-			return pass, nil
+			return []byte(pass), nil
 		}
 		i, err := agessh.NewEncryptedSSHIdentity(pubKey, pemBytes, passphrasePrompt)
 		if err != nil {
 			return nil, err
 		}
-		return []age.Identity{i}, nil
+		return []age.Identity{&sshIdentity{i, pubKey}}, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("malformed SSH identity in %q: %v", name, err)
 	}
 
+	if signer, err := ssh.ParsePrivateKey(pemBytes); err == nil {
+		return []age.Identity{&sshIdentity{id, signer.PublicKey()}}, nil
+	}
 	return []age.Identity{id}, nil
 }
 
@@ -243,6 +290,14 @@ func identitiesToRecipients(ids []age.Identity) ([]age.Recipient, error) {
 			recipients = append(recipients, id.Recipient())
 		case *agessh.EncryptedSSHIdentity:
 			recipients = append(recipients, id.Recipient())
+		case *sshIdentity:
+			r, err := identitiesToRecipients([]age.Identity{id.Identity})
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, &namedRecipient{r[0], sshRecipientName(id.publicKey)})
+		case *plugin.Identity:
+			recipients = append(recipients, id.Recipient())
 		case *EncryptedIdentity:
 			r, err := id.Recipients()
 			if err != nil {
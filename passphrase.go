@@ -0,0 +1,268 @@
+package nknwallet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/nknorg/nkn/v2/util/password"
+)
+
+// ErrNoPassphraseProvider is returned when a passphrase is needed but the
+// store has no PassphraseProvider.
+var ErrNoPassphraseProvider = errors.New("A passphrase is needed but no passphrase provider is configured.")
+
+// PassphraseRequest describes a passphrase asked for.
+type PassphraseRequest struct {
+	// Prompt is the question shown to a user, e.g. `Enter passphrase for
+	// identity file "key.txt"`.
+	Prompt string
+	// New is set when the passphrase is chosen to encrypt with rather than
+	// to decrypt.
+	New bool
+	// Change is set with New when the passphrase replaces the one something
+	// is protected with now, e.g. by change password or a rekey.
+	Change bool
+}
+
+// PassphraseProvider supplies the passphrases of accounts, master secrets and
+// encrypted identity files. The store only asks for a passphrase when it needs
+// one.
+type PassphraseProvider interface {
+	Passphrase(req PassphraseRequest) (string, error)
+}
+
+// WithPassphraseProvider sets where the store gets passphrases from. Without
+// one every operation needing a passphrase fails with ErrNoPassphraseProvider;
+// the store never reads from the terminal unless TTYPassphraseProvider is
+// set.
+func WithPassphraseProvider(p PassphraseProvider) StoreOption {
+	return func(s *Store) {
+		s.passphrase = p
+	}
+}
+
+// PassphraseProvider returns the passphrase provider of the store.
+func (s *Store) PassphraseProvider() PassphraseProvider {
+	if s.passphrase == nil {
+		return noPassphraseProvider{}
+	}
+	return s.passphrase
+}
+
+type noPassphraseProvider struct{}
+
+func (noPassphraseProvider) Passphrase(req PassphraseRequest) (string, error) {
+	return "", ErrNoPassphraseProvider
+}
+
+// staticPassphrase answers every request with the same passphrase.
+type staticPassphrase string
+
+func (p staticPassphrase) Passphrase(req PassphraseRequest) (string, error) {
+	return string(p), nil
+}
+
+// TTYPassphraseProvider prompts for passphrases on the terminal. A new
+// passphrase is asked for twice; if it is left empty a random one is
+// generated and printed.
+type TTYPassphraseProvider struct{}
+
+func (TTYPassphraseProvider) Passphrase(req PassphraseRequest) (string, error) {
+	if !req.New {
+		pass, err := password.GetPassword(req.Prompt)
+		if err != nil {
+			return "", fmt.Errorf("could not read passphrase: %v", err)
+		}
+		return string(pass), nil
+	}
+
+	pass, err := password.GetPassword(req.Prompt + " (leave empty to autogenerate a secure one)")
+	if err != nil {
+		return "", fmt.Errorf("Could not read passphrase: %v", err)
+	}
+	p := string(pass)
+	if p == "" {
+		p = GeneratePassphrase()
+		_, err := fmt.Printf("Using autogenerated passphrase %q\n", p)
+		if err != nil {
+			return "", fmt.Errorf("Could not print passphrase: %v", err)
+		}
+	} else {
+		confirm, err := password.GetPassword("Confirm passphrase")
+		if err != nil {
+			return "", fmt.Errorf("Could not read passphrase: %v", err)
+		}
+		if string(confirm) != p {
+			return "", fmt.Errorf("Passphrases didn't match")
+		}
+	}
+	return p, nil
+}
+
+// EnvPassphraseProvider takes the passphrase from the environment variable
+// Name.
+type EnvPassphraseProvider struct {
+	Name string
+}
+
+func (p EnvPassphraseProvider) Passphrase(req PassphraseRequest) (string, error) {
+	pass, ok := os.LookupEnv(p.Name)
+	if !ok {
+		return "", fmt.Errorf("Environment variable %s with the passphrase is not set.", p.Name)
+	}
+	return checkPassphrase(pass)
+}
+
+// FilePassphraseProvider takes the passphrase from the first line of the file
+// Path.
+type FilePassphraseProvider struct {
+	Path string
+}
+
+func (p FilePassphraseProvider) Passphrase(req PassphraseRequest) (string, error) {
+	dat, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", fmt.Errorf("Could not read passphrase file: %v", err)
+	}
+	return checkPassphrase(firstLine(dat))
+}
+
+// FDPassphraseProvider reads the passphrase from the first line of an
+// inherited file descriptor, e.g. a pipe set up by the parent process. The
+// descriptor is read once; every request gets the same passphrase.
+type FDPassphraseProvider struct {
+	fd   uintptr
+	once sync.Once
+	pass string
+	err  error
+}
+
+// NewFDPassphraseProvider returns a FDPassphraseProvider reading from fd.
+func NewFDPassphraseProvider(fd int) *FDPassphraseProvider {
+	return &FDPassphraseProvider{fd: uintptr(fd)}
+}
+
+func (p *FDPassphraseProvider) Passphrase(req PassphraseRequest) (string, error) {
+	p.once.Do(func() {
+		f := os.NewFile(p.fd, fmt.Sprintf("fd %d", p.fd))
+		if f == nil {
+			p.err = fmt.Errorf("Invalid passphrase file descriptor %d.", p.fd)
+			return
+		}
+		defer f.Close()
+		line, err := bufio.NewReader(f).ReadString('\n')
+		if err != nil && len(line) == 0 {
+			p.err = fmt.Errorf("Could not read passphrase from file descriptor %d: %v", p.fd, err)
+			return
+		}
+		p.pass = strings.TrimRight(line, "\r\n")
+	})
+	if p.err != nil {
+		return "", p.err
+	}
+	return checkPassphrase(p.pass)
+}
+
+// CommandPassphraseProvider runs an external command like `pass show nkn` or
+// a pinentry wrapper and takes the passphrase from the first line of its
+// output. The command gets the prompt in NKN_WALLET_PASSPHRASE_PROMPT and
+// NKN_WALLET_PASSPHRASE_NEW=1 when a new passphrase is asked for. Its stdin
+// and stderr are those of the process.
+type CommandPassphraseProvider struct {
+	Command []string
+}
+
+func (p CommandPassphraseProvider) Passphrase(req PassphraseRequest) (string, error) {
+	if len(p.Command) == 0 {
+		return "", errors.New("Passphrase command is empty.")
+	}
+	cmd := exec.Command(p.Command[0], p.Command[1:]...)
+	cmd.Env = append(os.Environ(), "NKN_WALLET_PASSPHRASE_PROMPT="+req.Prompt)
+	if req.New {
+		cmd.Env = append(cmd.Env, "NKN_WALLET_PASSPHRASE_NEW=1")
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Passphrase command failed: %v", err)
+	}
+	return checkPassphrase(firstLine(out))
+}
+
+// ErrNewPassphraseSource is returned by SplitPassphraseProvider when a
+// passphrase is changed and the new one is asked for from the source that
+// already gave the passphrase to decrypt with.
+var ErrNewPassphraseSource = errors.New("A passphrase is changed, but the source of the new passphrase already gave the passphrase to decrypt with. Give the new passphrase from a separate source.")
+
+// SplitPassphraseProvider asks Current for passphrases to decrypt with and
+// New for passphrases to encrypt with.
+//
+// Non-interactive providers answer every request with the same secret. If New
+// is nil, new passphrases are asked from Current too. Only once Current gave a
+// passphrase to decrypt with, changed passphrases are refused with
+// ErrNewPassphraseSource, so that changing a passphrase never silently
+// re-encrypts with the old one. Encrypting new accounts, master secrets or
+// metadata still works with a single source.
+type SplitPassphraseProvider struct {
+	Current PassphraseProvider
+	New     PassphraseProvider
+
+	mu      sync.Mutex
+	decrypt bool
+}
+
+func (p *SplitPassphraseProvider) Passphrase(req PassphraseRequest) (string, error) {
+	if req.New && p.New != nil {
+		return p.New.Passphrase(req)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if req.New && req.Change && p.decrypt {
+		return "", ErrNewPassphraseSource
+	}
+	pass, err := p.Current.Passphrase(req)
+	if err == nil && !req.New {
+		p.decrypt = true
+	}
+	return pass, err
+}
+
+func firstLine(dat []byte) string {
+	if i := bytes.IndexByte(dat, '\n'); i >= 0 {
+		dat = dat[:i]
+	}
+	return strings.TrimRight(string(dat), "\r")
+}
+
+func checkPassphrase(pass string) (string, error) {
+	if len(pass) == 0 {
+		return "", errors.New("Passphrase is empty.")
+	}
+	return pass, nil
+}
+
+// passphraseFunc returns a function asking pp for a passphrase to decrypt
+// with, as used by LazyScryptIdentity and EncryptedIdentity.
+func passphraseFunc(pp PassphraseProvider, prompt string) func() (string, error) {
+	return func() (string, error) {
+		return pp.Passphrase(PassphraseRequest{Prompt: prompt})
+	}
+}
+
+// newPassphrase asks pp for a passphrase to encrypt with.
+func newPassphrase(pp PassphraseProvider) (string, error) {
+	return pp.Passphrase(PassphraseRequest{Prompt: "Enter passphrase", New: true})
+}
+
+// changedPassphrase asks pp for a passphrase replacing the current one.
+func changedPassphrase(pp PassphraseProvider) (string, error) {
+	return pp.Passphrase(PassphraseRequest{Prompt: "Enter new passphrase", New: true, Change: true})
+}
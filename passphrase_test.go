@@ -0,0 +1,119 @@
+package nknwallet
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSplitPassphraseProvider(t *testing.T) {
+	decrypt := PassphraseRequest{Prompt: "Enter passphrase"}
+	encrypt := PassphraseRequest{Prompt: "Enter passphrase", New: true}
+	change := PassphraseRequest{Prompt: "Enter new passphrase", New: true, Change: true}
+
+	tests := []struct {
+		name     string
+		provider *SplitPassphraseProvider
+		requests []PassphraseRequest
+		want     []string
+		err      error
+	}{
+		{
+			name:     "new only from a single source",
+			provider: &SplitPassphraseProvider{Current: staticPassphrase("old")},
+			requests: []PassphraseRequest{encrypt, encrypt},
+			want:     []string{"old", "old"},
+		},
+		{
+			name:     "decrypt only from a single source",
+			provider: &SplitPassphraseProvider{Current: staticPassphrase("old")},
+			requests: []PassphraseRequest{decrypt, decrypt},
+			want:     []string{"old", "old"},
+		},
+		{
+			name:     "new account after decrypt from a single source",
+			provider: &SplitPassphraseProvider{Current: staticPassphrase("old")},
+			requests: []PassphraseRequest{decrypt, encrypt, decrypt, encrypt},
+			want:     []string{"old", "old", "old", "old"},
+		},
+		{
+			name:     "change without decrypt from a single source",
+			provider: &SplitPassphraseProvider{Current: staticPassphrase("old")},
+			requests: []PassphraseRequest{change},
+			want:     []string{"old"},
+		},
+		{
+			name:     "change after decrypt from a single source",
+			provider: &SplitPassphraseProvider{Current: staticPassphrase("old")},
+			requests: []PassphraseRequest{decrypt, encrypt, change},
+			want:     []string{"old", "old"},
+			err:      ErrNewPassphraseSource,
+		},
+		{
+			name:     "change after decrypt from a separate source",
+			provider: &SplitPassphraseProvider{Current: staticPassphrase("old"), New: staticPassphrase("new")},
+			requests: []PassphraseRequest{decrypt, change, decrypt, encrypt},
+			want:     []string{"old", "new", "old", "new"},
+		},
+		{
+			name:     "failed decrypt",
+			provider: &SplitPassphraseProvider{Current: noPassphraseProvider{}},
+			requests: []PassphraseRequest{decrypt, change},
+			err:      ErrNoPassphraseProvider,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var err error
+			for _, req := range tt.requests {
+				var pass string
+				if pass, err = tt.provider.Passphrase(req); err != nil {
+					break
+				}
+				got = append(got, pass)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("passphrases = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("passphrases = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSinglePassphraseSource(t *testing.T) {
+	s, err := NewStore("", WithBackend(NewMemBackend()), WithScryptWorkFactor(10),
+		WithPassphraseProvider(&SplitPassphraseProvider{Current: staticPassphrase("secret")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := s.NewWallet("scrypt", AccountKey{}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveWallet(w); err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.DecryptWallet(w.ID, AccountKey{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a cron job decrypting one account and creating another
+	w2, err := s.NewWallet("scrypt", AccountKey{}, 0, nil)
+	if err != nil {
+		t.Fatalf("new account after a decrypt from a single source: %v", err)
+	}
+	if err := s.SaveWallet(w2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPassword(d); !errors.Is(err, ErrNewPassphraseSource) {
+		t.Fatalf("SetPassword from a single source = %v, want ErrNewPassphraseSource", err)
+	}
+}
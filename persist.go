@@ -0,0 +1,122 @@
+package nknwallet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultBackups is the number of backup generations kept next to the wallet
+// file when no other value is set with WithBackups.
+const DefaultBackups = 3
+
+// writeFileAtomic writes dat to a temporary file in the directory of path,
+// flushes it to disk and renames it over path. A crash at any point leaves
+// either the old or the new content at path, never a truncated file.
+func writeFileAtomic(path string, dat []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err = f.Write(dat); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes the directory entry of a renamed file. This is best effort
+// since not every platform supports syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// scrubFile overwrites the content of the file at path with zeros before
+// removing it. This is best effort: file systems which copy on write or
+// journal data may keep the old content elsewhere.
+func scrubFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err == nil {
+		_, err = f.Write(make([]byte, fi.Size()))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// backupPath returns the path of the n-th backup generation of path, with 1
+// being the most recent one.
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// rotateBackups shifts the existing backup generations of path by one, drops
+// the oldest one and copies the current content of path into the most recent
+// generation.
+func rotateBackups(path string, generations int) error {
+	if generations <= 0 {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(dat) == 0 {
+		return nil
+	}
+
+	for i := generations - 1; i >= 1; i-- {
+		err := os.Rename(backupPath(path, i), backupPath(path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return writeFileAtomic(backupPath(path, 1), dat, fi.Mode().Perm())
+}
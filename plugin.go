@@ -0,0 +1,64 @@
+package nknwallet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/omani/nkn-wallet/internal/plugin"
+)
+
+// Recipients like "age1yubikey1..." and identities like
+// "AGE-PLUGIN-YUBIKEY-1..." are handled by age plugins: binaries named
+// age-plugin-<name> in $PATH, which are run for every encryption and
+// decryption and may talk to hardware tokens or ask the user for a PIN.
+
+// isPluginRecipient reports whether recipient is handled by an age plugin,
+// i.e. has the form "age1<name>1...".
+func isPluginRecipient(recipient string) bool {
+	return strings.HasPrefix(recipient, "age1") && strings.Count(recipient, "1") > 1
+}
+
+// pluginUI returns the callbacks of age plugins that want to talk to the user.
+// Messages are printed to stderr; PINs and confirmations are asked from pp.
+func pluginUI(pp PassphraseProvider) *plugin.ClientUI {
+	if pp == nil {
+		pp = noPassphraseProvider{}
+	}
+	return &plugin.ClientUI{
+		DisplayMessage: func(name, message string) error {
+			fmt.Fprintf(os.Stderr, "age-plugin-%s: %s\n", name, message)
+			return nil
+		},
+		RequestValue: func(name, prompt string, secret bool) (string, error) {
+			value, err := pp.Passphrase(PassphraseRequest{Prompt: fmt.Sprintf("age-plugin-%s: %s", name, prompt)})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not read value for age-plugin-%s: %v\n", name, err)
+			}
+			return value, err
+		},
+		Confirm: func(name, prompt, yes, no string) (bool, error) {
+			if no == "" {
+				prompt += fmt.Sprintf(" (enter %q)", yes)
+			} else {
+				prompt += fmt.Sprintf(" (enter %q or %q)", yes, no)
+			}
+			answer, err := pp.Passphrase(PassphraseRequest{Prompt: fmt.Sprintf("age-plugin-%s: %s", name, prompt)})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not read value for age-plugin-%s: %v\n", name, err)
+				return false, err
+			}
+			switch answer {
+			case yes:
+				return true, nil
+			case no:
+				return false, nil
+			}
+			return false, errors.New("Invalid answer.")
+		},
+		WaitTimer: func(name string) {
+			fmt.Fprintf(os.Stderr, "Waiting on age-plugin-%s...\n", name)
+		},
+	}
+}
@@ -0,0 +1,160 @@
+package nknwallet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/omani/nkn-wallet/internal/bech32"
+	"github.com/omani/nkn-wallet/internal/format"
+)
+
+func init() {
+	helpers["age-plugin-stub"] = stubPlugin
+}
+
+// stubPlugin is a minimal age plugin "stub". Its recipients and identities
+// carry a key ID; it "wraps" file keys in a stanza naming the key ID of the
+// recipient and unwraps only stanzas naming the key ID of its identity.
+func stubPlugin() int {
+	if len(os.Args) != 2 {
+		return 2
+	}
+	r := format.NewStanzaReader(bufio.NewReader(os.Stdin))
+	read := func() *format.Stanza {
+		s, err := r.ReadStanza()
+		if err != nil {
+			os.Exit(3)
+		}
+		return s
+	}
+	write := func(typ string, body []byte, args ...string) {
+		s := &format.Stanza{Type: typ, Args: args, Body: body}
+		if err := s.Marshal(os.Stdout); err != nil {
+			os.Exit(3)
+		}
+	}
+	keyID := func(encoding string) string {
+		_, data, err := bech32.Decode(encoding)
+		if err != nil {
+			os.Exit(3)
+		}
+		return hex.EncodeToString(data)
+	}
+
+	var ids []string
+	var fileKey []byte
+	var stanzas []*format.Stanza
+	for s := read(); s.Type != "done"; s = read() {
+		switch s.Type {
+		case "add-recipient", "add-identity":
+			ids = append(ids, keyID(s.Args[0]))
+		case "wrap-file-key":
+			fileKey = s.Body
+		case "recipient-stanza":
+			stanzas = append(stanzas, s)
+		}
+	}
+
+	switch os.Args[1] {
+	case "--age-plugin=recipient-v1":
+		for _, id := range ids {
+			write("recipient-stanza", fileKey, "0", "stub", id)
+			read()
+		}
+	case "--age-plugin=identity-v1":
+		for _, s := range stanzas {
+			if len(s.Args) == 3 && s.Args[1] == "stub" && s.Args[2] == ids[0] {
+				write("file-key", s.Body, "0")
+				read()
+				break
+			}
+		}
+	default:
+		return 2
+	}
+	write("done", nil)
+	return 0
+}
+
+func stubKey(t *testing.T, id byte) (recipient, identity string) {
+	t.Helper()
+	var err error
+	if recipient, err = bech32.Encode("age1stub", []byte{id}); err != nil {
+		t.Fatal(err)
+	}
+	if identity, err = bech32.Encode("AGE-PLUGIN-STUB-", []byte{id}); err != nil {
+		t.Fatal(err)
+	}
+	return recipient, identity
+}
+
+func TestPluginRecipientAndIdentity(t *testing.T) {
+	dir := t.TempDir()
+	writeHelper(t, dir, "age-plugin-stub", "age-plugin-stub")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	recipient, identity := stubKey(t, 1)
+	_, otherIdentity := stubKey(t, 2)
+	if !isPluginRecipient(recipient) {
+		t.Fatalf("%s is not a plugin recipient", recipient)
+	}
+	identityFile := filepath.Join(dir, "stub.txt")
+	otherIdentityFile := filepath.Join(dir, "other.txt")
+	if err := os.WriteFile(identityFile, []byte("# stub plugin key\n"+identity+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(otherIdentityFile, []byte(otherIdentity+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// age level: the recipient wraps and the identity unwraps through the
+	// plugin
+	r, err := parseRecipient(recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	if err := encrypt([]age.Recipient{r}, bytes.NewBufferString("secret"), out); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := parseIdentitiesFile(identityFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := &bytes.Buffer{}
+	if err := decrypt(ids, bytes.NewReader(out.Bytes()), plain); err != nil {
+		t.Fatal(err)
+	}
+	if plain.String() != "secret" {
+		t.Fatalf("decrypted %q, want %q", plain, "secret")
+	}
+
+	// store level: an account encrypted to the plugin recipient is
+	// decrypted with the plugin identity only
+	s, err := NewStore("", WithBackend(NewMemBackend()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := s.NewWallet("recipient", AccountKey{Recipient: recipient}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveWallet(w); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DecryptWallet(w.ID, AccountKey{Identity: otherIdentityFile}, nil); err == nil {
+		t.Fatal("account was decrypted with another plugin identity")
+	}
+	d, err := s.DecryptWallet(w.ID, AccountKey{Identity: identityFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(d.Seed(), w.Seed()) {
+		t.Fatal("decrypted seed differs")
+	}
+}
@@ -0,0 +1,87 @@
+package nknwallet
+
+import (
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/ssh"
+)
+
+// namedRecipient is a recipient together with its encoding, so recipients
+// that don't have a String method (like SSH keys) can still be recorded next
+// to the armor of an account.
+type namedRecipient struct {
+	age.Recipient
+	name string
+}
+
+// sshIdentity is an SSH identity together with its public key, which agessh
+// does not expose.
+type sshIdentity struct {
+	age.Identity
+	publicKey ssh.PublicKey
+}
+
+func sshRecipientName(pk ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pk)))
+}
+
+// normalizeRecipient returns the canonical form of a recipient string, which
+// for SSH keys is the key without its comment.
+func normalizeRecipient(recipient string) string {
+	fields := strings.Fields(recipient)
+	if len(fields) >= 2 && strings.HasPrefix(fields[0], "ssh-") {
+		return fields[0] + " " + fields[1]
+	}
+	return strings.TrimSpace(recipient)
+}
+
+// RecipientName returns the canonical encoding of a recipient ("age1..." or
+// an SSH public key without comment), which parses back into the recipient.
+func RecipientName(r age.Recipient) (string, error) {
+	switch r := r.(type) {
+	case *namedRecipient:
+		return r.name, nil
+	case *age.X25519Recipient:
+		return r.String(), nil
+	}
+	return "", fmt.Errorf("recipient of type %T has no encoding", r)
+}
+
+// RecipientNames returns the canonical encodings of recipients, see
+// RecipientName.
+func RecipientNames(recipients []age.Recipient) ([]string, error) {
+	var names []string
+	for _, r := range recipients {
+		name, err := RecipientName(r)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// isScrypt reports whether recipients is a passphrase.
+func isScrypt(recipients []age.Recipient) bool {
+	for _, r := range recipients {
+		if _, ok := r.(*age.ScryptRecipient); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recordedRecipients returns the names of recipients to record with an
+// account, or nil for a passphrase or recipients without encoding.
+func recordedRecipients(recipients []age.Recipient) []string {
+	if isScrypt(recipients) {
+		return nil
+	}
+	names, err := RecipientNames(recipients)
+	if err != nil {
+		return nil
+	}
+	return names
+}
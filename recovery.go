@@ -0,0 +1,306 @@
+package nknwallet
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/nknorg/nkn-sdk-go"
+	"golang.org/x/crypto/ssh"
+)
+
+// Recovery recipients are break-glass keys every account of a store must be
+// decryptable with. They are appended to the recipients of IDENTITY accounts.
+// SCRYPT and TWOFACTOR accounts can't share their armor with them, so their
+// seed is encrypted to the recovery recipients in a separate RecoveryArmor.
+
+// encryptedAccount is an account encrypted by Store.encryptAccount.
+type encryptedAccount struct {
+	armor         string
+	recoveryArmor string
+	recovery      []string
+	kdf           *KDF
+}
+
+// recoveryRecipients parses the recovery recipients of the store. The caller
+// must hold s.mu.
+func (s *Store) recoveryRecipients() ([]age.Recipient, []string, error) {
+	names := s.header.Settings.RecoveryRecipients
+	var recipients []age.Recipient
+	for _, name := range names {
+		r, err := parseRecipient(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("recovery recipient %q: %v", name, err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, names, nil
+}
+
+// encryptAccount encrypts account to recipients and the recovery recipients
+// of the store.
+func (s *Store) encryptAccount(account *nkn.Account, recipients []age.Recipient) (*encryptedAccount, error) {
+	s.mu.RLock()
+	recovery, names, err := s.recoveryRecipients()
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return encryptAccountWithRecovery(account, recipients, recovery, names)
+}
+
+func encryptAccountWithRecovery(account *nkn.Account, recipients, recovery []age.Recipient, names []string) (*encryptedAccount, error) {
+	if len(recovery) == 0 {
+		armor, err := encryptAccount(account, recipients)
+		if err != nil {
+			return nil, err
+		}
+		return &encryptedAccount{armor: string(armor), kdf: armorKDF(string(armor))}, nil
+	}
+
+	if isScrypt(recipients) {
+		armor, err := encryptAccount(account, recipients)
+		if err != nil {
+			return nil, err
+		}
+		recoveryArmor, err := encryptAccount(account, recovery)
+		if err != nil {
+			return nil, err
+		}
+		return &encryptedAccount{armor: string(armor), recoveryArmor: string(recoveryArmor), recovery: names, kdf: armorKDF(string(armor))}, nil
+	}
+
+	all := append(append([]age.Recipient{}, recipients...), recovery...)
+	armor, err := encryptAccount(account, all)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedAccount{armor: string(armor), recovery: names}, nil
+}
+
+// recoveryArmor encrypts account to the recovery recipients of the store for
+// a TWOFACTOR account. It returns an empty armor if there are none.
+func (s *Store) recoveryArmor(account *nkn.Account) (string, []string, error) {
+	s.mu.RLock()
+	recovery, names, err := s.recoveryRecipients()
+	s.mu.RUnlock()
+	if err != nil || len(recovery) == 0 {
+		return "", nil, err
+	}
+	armor, err := encryptAccount(account, recovery)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(armor), names, nil
+}
+
+// RecoveryRecipients returns the recovery recipients of the store.
+func (s *Store) RecoveryRecipients() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.header.Settings.RecoveryRecipients
+}
+
+// SetRecoveryRecipients sets the recovery recipients every new or rekeyed
+// account is also encrypted to. Existing accounts are not changed; use
+// VerifyPolicy to find them.
+func (s *Store) SetRecoveryRecipients(recipients []string) error {
+	var names []string
+	for _, r := range recipients {
+		rec, err := parseRecipient(r)
+		if err != nil {
+			return err
+		}
+		name, err := RecipientName(rec)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	return s.update(func() error {
+		s.header.Settings.RecoveryRecipients = names
+		return nil
+	})
+}
+
+// PolicyViolation is an account that doesn't satisfy the recovery policy of
+// the store.
+type PolicyViolation struct {
+	ID      int
+	Address string
+	Reason  string
+}
+
+// VerifyPolicy checks that every account can be decrypted by the recovery
+// recipients of the store. With the identity file of a recovery key
+// (recoveryIdentity) the armors are actually decrypted. Without it the stanzas
+// of the armors are inspected: SSH recipients are identified by their tag,
+// X25519 recipients can't be told apart, so for them the recipients recorded
+// with the account and the number of stanzas are checked.
+func (s *Store) VerifyPolicy(recoveryIdentity string) ([]PolicyViolation, error) {
+	s.mu.RLock()
+	names := s.header.Settings.RecoveryRecipients
+	wallets := s.wallets
+	s.mu.RUnlock()
+	if len(names) == 0 {
+		return nil, errors.New("Wallet has no recovery recipients.")
+	}
+
+	var identities []age.Identity
+	if len(recoveryIdentity) > 0 {
+		var err error
+		identities, err = parseIdentitiesFile(recoveryIdentity, s.PassphraseProvider())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var violations []PolicyViolation
+	for _, w := range wallets {
+		if w.IsWatchOnly() || w.IsExternal() {
+			continue
+		}
+		if reason := checkRecovery(w, names, identities); len(reason) > 0 {
+			violations = append(violations, PolicyViolation{ID: w.ID, Address: w.Address(), Reason: reason})
+		}
+	}
+	return violations, nil
+}
+
+// checkRecovery returns why w can't be decrypted by the recovery recipients,
+// or "".
+func checkRecovery(w *Wallet, names []string, identities []age.Identity) string {
+	armor := w.Armor
+	switch strings.ToLower(w.Type) {
+	case "scrypt", "twofactor":
+		if len(w.RecoveryArmor) == 0 {
+			return "passphrase encrypted account has no recovery armor"
+		}
+		armor = w.RecoveryArmor
+	}
+
+	if identities != nil {
+		out := &bytes.Buffer{}
+		if err := decrypt(append([]age.Identity{rejectScryptIdentity{}}, identities...), strings.NewReader(armor), out); err != nil {
+			return fmt.Sprintf("recovery identity can't decrypt the account: %v", err)
+		}
+		return ""
+	}
+
+	stanzas, err := armorStanzas(armor)
+	if err != nil {
+		return fmt.Sprintf("invalid armor: %v", err)
+	}
+	x25519 := 0
+	for _, st := range stanzas {
+		if st.Type == "X25519" {
+			x25519++
+		}
+	}
+	wantX25519 := 0
+	for _, name := range names {
+		if strings.HasPrefix(name, "ssh-") {
+			tag, err := sshTag(name)
+			if err != nil {
+				return err.Error()
+			}
+			if !hasStanza(stanzas, strings.Fields(name)[0], tag) {
+				return fmt.Sprintf("armor has no stanza for recovery recipient %s", name)
+			}
+			continue
+		}
+		if indexOf(w.Recovery, name) < 0 {
+			return fmt.Sprintf("account is not recorded as encrypted to recovery recipient %s", name)
+		}
+		// the stanzas of plugins can't be told apart without the plugin
+		if !isPluginRecipient(name) {
+			wantX25519++
+		}
+	}
+	if armor == w.Armor {
+		for _, name := range w.Recipients {
+			if strings.HasPrefix(name, "age1") && !isPluginRecipient(name) {
+				wantX25519++
+			}
+		}
+	}
+	if x25519 < wantX25519 {
+		return fmt.Sprintf("armor has %d X25519 stanzas, expected at least %d", x25519, wantX25519)
+	}
+	return ""
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// stanzaHeader is the type and the arguments of a recipient stanza of an age
+// header.
+type stanzaHeader struct {
+	Type string
+	Args []string
+}
+
+// armorStanzas returns the recipient stanzas of an (armored) age file without
+// decrypting it.
+func armorStanzas(s string) ([]stanzaHeader, error) {
+	var r io.Reader = strings.NewReader(s)
+	if strings.HasPrefix(strings.TrimSpace(s), armor.Header) {
+		r = armor.NewReader(strings.NewReader(strings.TrimSpace(s)))
+	}
+	br := bufio.NewReader(r)
+	intro, err := br.ReadString('\n')
+	if err != nil || intro != "age-encryption.org/v1\n" {
+		return nil, errors.New("not an age file")
+	}
+
+	var stanzas []stanzaHeader
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, errors.New("truncated age header")
+		}
+		switch {
+		case strings.HasPrefix(line, "-> "):
+			fields := strings.Fields(strings.TrimPrefix(line, "-> "))
+			if len(fields) == 0 {
+				return nil, errors.New("malformed stanza")
+			}
+			stanzas = append(stanzas, stanzaHeader{Type: fields[0], Args: fields[1:]})
+		case strings.HasPrefix(line, "--- "):
+			return stanzas, nil
+		}
+	}
+}
+
+// sshTag returns the tag age uses to identify the stanzas of an SSH
+// recipient: the first 4 bytes of the SHA-256 of the key.
+func sshTag(recipient string) (string, error) {
+	pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(recipient))
+	if err != nil {
+		return "", fmt.Errorf("recovery recipient %q: %v", recipient, err)
+	}
+	sum := sha256.Sum256(pk.Marshal())
+	return base64.RawStdEncoding.EncodeToString(sum[:4]), nil
+}
+
+func hasStanza(stanzas []stanzaHeader, typ, tag string) bool {
+	for _, st := range stanzas {
+		if st.Type == typ && len(st.Args) > 0 && st.Args[0] == tag {
+			return true
+		}
+	}
+	return false
+}
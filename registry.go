@@ -0,0 +1,259 @@
+package nknwallet
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+// The recipient registry of a store maps names like "alice" or "ops-group" to
+// age or SSH recipients and to other names, so a team doesn't have to pass
+// public keys around. Accounts encrypted to names record them and are
+// rebuilt from the registry when they are rekeyed.
+
+var recipientNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// validRecipientName reports whether name can be used in the registry. Names
+// must not look like recipients.
+func validRecipientName(name string) bool {
+	return recipientNamePattern.MatchString(name) && !strings.HasPrefix(name, "age1")
+}
+
+// NamedRecipients returns the recipient registry of the store.
+func (s *Store) NamedRecipients() map[string][]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	registry := map[string][]string{}
+	for name, members := range s.header.Settings.Recipients {
+		registry[name] = append([]string{}, members...)
+	}
+	return registry
+}
+
+// SetNamedRecipient sets the members of name in the recipient registry,
+// creating it if needed. A member is an age or SSH recipient, a
+// "github:<user>" recipient or another name of the registry. The keys of
+// "github:<user>" members are pinned. Accounts encrypted to name are not
+// changed; use AccountsByNamedRecipient to find them and
+// RekeyToNamedRecipients to rekey them.
+func (s *Store) SetNamedRecipient(name string, members []string) error {
+	if !validRecipientName(name) {
+		return fmt.Errorf("Invalid recipient name %q. Use letters, digits, '.', '_' and '-'.", name)
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("Recipient name %s needs at least one member.", name)
+	}
+
+	// keyServerRecipients updates the store itself, so pin the keys of
+	// "github:" members before taking the lock
+	for _, m := range members {
+		if strings.HasPrefix(m, "github:") {
+			if _, err := s.ParseRecipient(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.update(func() error {
+		registry := map[string][]string{}
+		for n, m := range s.header.Settings.Recipients {
+			registry[n] = m
+		}
+
+		var normalized []string
+		for _, m := range members {
+			if strings.HasPrefix(m, "github:") {
+				if _, ok := s.header.Settings.PinnedKeys[m]; !ok {
+					return fmt.Errorf("No keys are pinned for %s.", m)
+				}
+			} else if _, ok := registry[m]; !ok {
+				r, err := parseRecipient(m)
+				if err != nil {
+					if validRecipientName(m) {
+						return fmt.Errorf("Unknown recipient name %s.", m)
+					}
+					return err
+				}
+				if m, err = RecipientName(r); err != nil {
+					return err
+				}
+			}
+			if indexOf(normalized, m) < 0 {
+				normalized = append(normalized, m)
+			}
+		}
+		registry[name] = normalized
+		if _, err := resolveNamed(registry, []string{name}); err != nil {
+			return err
+		}
+		s.header.Settings.Recipients = registry
+		return nil
+	})
+}
+
+// RemoveNamedRecipient removes name from the recipient registry. Names still
+// used by other names or by accounts can't be removed.
+func (s *Store) RemoveNamedRecipient(name string) error {
+	return s.update(func() error {
+		registry := s.header.Settings.Recipients
+		if _, ok := registry[name]; !ok {
+			return fmt.Errorf("Unknown recipient name %s.", name)
+		}
+		for n, members := range registry {
+			if indexOf(members, name) >= 0 {
+				return fmt.Errorf("Recipient name %s is a member of %s.", name, n)
+			}
+		}
+		for _, w := range s.wallets {
+			if indexOf(w.NamedRecipients, name) >= 0 {
+				return fmt.Errorf("Account %d is encrypted to %s. Rekey it first.", w.ID, name)
+			}
+		}
+		delete(registry, name)
+		return nil
+	})
+}
+
+// ResolveRecipients returns the recipients the names of the recipient registry
+// stand for. "github:<user>" members stand for their pinned keys.
+func (s *Store) ResolveRecipients(names []string) ([]age.Recipient, error) {
+	s.mu.RLock()
+	resolved, err := resolveNamed(s.header.Settings.Recipients, names)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	var recipients []age.Recipient
+	for _, name := range resolved {
+		r, err := s.ParseRecipient(name)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r...)
+	}
+	return recipients, nil
+}
+
+// resolveNamed expands names to the recipients they stand for, without
+// duplicates.
+func resolveNamed(registry map[string][]string, names []string) ([]string, error) {
+	var resolved []string
+	var expand func(name string, seen []string) error
+	expand = func(name string, seen []string) error {
+		members, ok := registry[name]
+		if !ok {
+			return fmt.Errorf("Unknown recipient name %s.", name)
+		}
+		if indexOf(seen, name) >= 0 {
+			return fmt.Errorf("Recipient name %s contains itself.", name)
+		}
+		seen = append(seen, name)
+		for _, m := range members {
+			if _, ok := registry[m]; ok {
+				if err := expand(m, seen); err != nil {
+					return err
+				}
+			} else if indexOf(resolved, m) < 0 {
+				resolved = append(resolved, m)
+			}
+		}
+		return nil
+	}
+	for _, name := range names {
+		if err := expand(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(resolved) == 0 {
+		return nil, errors.New("Need at least one recipient.")
+	}
+	return resolved, nil
+}
+
+// dependsOn reports whether name is or contains target.
+func dependsOn(registry map[string][]string, name, target string, depth int) bool {
+	if name == target {
+		return true
+	}
+	if depth > len(registry) {
+		return false
+	}
+	for _, m := range registry[name] {
+		if dependsOn(registry, m, target, depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// AccountsByNamedRecipient returns the accounts encrypted to name, directly or
+// through another name containing it.
+func (s *Store) AccountsByNamedRecipient(name string) []*Wallet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var wallets []*Wallet
+	for _, w := range s.wallets {
+		for _, n := range w.NamedRecipients {
+			if dependsOn(s.header.Settings.Recipients, n, name, 0) {
+				wallets = append(wallets, w)
+				break
+			}
+		}
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].ID < wallets[j].ID })
+	return wallets
+}
+
+// RekeyToNamedRecipients re-encrypts the decrypted wallet to the recipients
+// names of the recipient registry stand for, and records the names with the
+// account.
+func (s *Store) RekeyToNamedRecipients(wallet *Wallet, names []string) error {
+	recipients, err := s.ResolveRecipients(names)
+	if err != nil {
+		return err
+	}
+	return s.rekey(wallet, recipients, names)
+}
+
+// NewWalletByNamedRecipients creates a new account encrypted to the recipients
+// names of the recipient registry stand for. Accounts can't be decrypted by
+// name, so index must be 0.
+func (s *Store) NewWalletByNamedRecipients(names []string, index int, config *nkn.WalletConfig) (*Wallet, error) {
+	if index > 0 {
+		return nil, errors.New("Use an identity file to decrypt the account.")
+	}
+	account, err := nkn.NewAccount(nil)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.RestoreFromSeedByNamedRecipients(account.Seed(), names)
+	if err != nil {
+		return nil, err
+	}
+	if w.config, err = nkn.MergeWalletConfig(config); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// RestoreFromSeedByNamedRecipients encrypts seed to the recipients names of
+// the recipient registry stand for.
+func (s *Store) RestoreFromSeedByNamedRecipients(seed []byte, names []string) (*Wallet, error) {
+	recipients, err := s.ResolveRecipients(names)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.restoreFromSeed(seed, func(account *nkn.Account) (*Wallet, error) {
+		return s.encryptToRecipients(account, recipients)
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.NamedRecipients = names
+	return w, nil
+}
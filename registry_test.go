@@ -0,0 +1,73 @@
+package nknwallet
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshKey returns a new ed25519 SSH public key in authorized_keys format.
+func sshKey(t *testing.T) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(sshPub)))
+}
+
+func TestNamedRecipientGitHubMember(t *testing.T) {
+	key := sshKey(t)
+	var fetched int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/alice.keys" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&fetched, 1)
+		fmt.Fprintln(w, key)
+	}))
+	defer server.Close()
+
+	s, err := NewStore("", WithBackend(NewMemBackend()), WithKeyServer(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNamedRecipient("team", []string{"github:alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNamedRecipient("ops", []string{"team", "github:alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNamedRecipient("nobody", []string{"github:bob"}); err == nil {
+		t.Fatal("SetNamedRecipient with a user without keys succeeded")
+	}
+	if pin, ok := s.PinnedKeys()["github:alice"]; !ok || len(pin.Keys) != 1 || pin.Keys[0] != key {
+		t.Fatalf("pinned keys of github:alice = %+v, want %s", pin, key)
+	}
+
+	w, err := s.RestoreFromSeedByNamedRecipients(bytes.Repeat([]byte{1}, 32), []string{"ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveWallet(w); err != nil {
+		t.Fatal(err)
+	}
+	if fetched := atomic.LoadInt32(&fetched); fetched != 1 {
+		t.Fatalf("keys of github:alice were fetched %d times, want once", fetched)
+	}
+	if len(w.Recipients) != 1 || w.Recipients[0] != normalizeRecipient(key) {
+		t.Fatalf("account is encrypted to %q, want the pinned key of github:alice", w.Recipients)
+	}
+}
@@ -0,0 +1,304 @@
+package nknwallet
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+// Status of an account in a RekeyReport.
+const (
+	RekeyStatusRekeyed = "rekeyed"
+	RekeyStatusSkipped = "skipped"
+	RekeyStatusFailed  = "failed"
+)
+
+// RekeyResult is the outcome of RekeyAll for a single account.
+type RekeyResult struct {
+	ID      int    `json:"id"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	// Resumed is set for accounts re-encrypted by an earlier, interrupted
+	// run and taken from the journal.
+	Resumed bool   `json:"resumed,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// RekeyReport lists which accounts RekeyAll migrated, skipped and failed to
+// decrypt.
+type RekeyReport struct {
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Recipients []string      `json:"recipients,omitempty"`
+	Results    []RekeyResult `json:"results"`
+}
+
+// Count returns the number of results with the given status.
+func (r *RekeyReport) Count(status string) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// RekeyAllOptions configures RekeyAll.
+type RekeyAllOptions struct {
+	// Journal is a file every re-encrypted account is appended to as soon
+	// as it is done. If RekeyAll is interrupted, the next run with the same
+	// journal and recipients takes those accounts from it instead of
+	// decrypting them again. The journal holds only the new armors and is
+	// removed once the store is saved. It is not used when re-encrypting
+	// with a passphrase.
+	Journal string
+	// Progress is called after every account.
+	Progress func(done, total int, result RekeyResult)
+	// NamedRecipients are the names of the recipient registry recipients
+	// were resolved from. They are recorded with the re-encrypted accounts.
+	NamedRecipients []string
+}
+
+// rekeyJournalEntry is a line of the journal of RekeyAll.
+type rekeyJournalEntry struct {
+	ID            int      `json:"id"`
+	OldArmor      string   `json:"old_armor"`
+	Type          string   `json:"type"`
+	Armor         string   `json:"armor"`
+	RecoveryArmor string   `json:"recovery_armor,omitempty"`
+	Recovery      []string `json:"recovery,omitempty"`
+	Recipients    []string `json:"recipients,omitempty"`
+	Named         []string `json:"named,omitempty"`
+	KDF           *KDF     `json:"kdf,omitempty"`
+}
+
+func armorHash(armor string) string {
+	sum := sha256.Sum256([]byte(armor))
+	return hex.EncodeToString(sum[:])
+}
+
+// readRekeyJournal returns the entries of the journal by the hash of the armor
+// they replace. A missing journal is empty; a truncated last line, as left by
+// a crash, is ignored.
+func readRekeyJournal(path string) (map[string]*rekeyJournalEntry, error) {
+	entries := map[string]*rekeyJournalEntry{}
+	if len(path) == 0 {
+		return entries, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		e := &rekeyJournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			continue
+		}
+		entries[e.OldArmor] = e
+	}
+	return entries, scanner.Err()
+}
+
+func sameRecipients(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RekeyAll decrypts every account encrypted to the identities of the identity
+// file oldIdentity and re-encrypts it to recipients, e.g. after the identity
+// leaked. All accounts are migrated in one transaction under the exclusive
+// lock of the store: either the store is saved with all of them or not at
+// all. Accounts that oldIdentity can't decrypt are skipped or reported as
+// failed; they don't stop the migration of the others. Only the outer layer of
+// TWOFACTOR accounts is replaced, their passphrase stays the same.
+func (s *Store) RekeyAll(oldIdentity string, recipients []age.Recipient, opts *RekeyAllOptions) (*RekeyReport, error) {
+	if opts == nil {
+		opts = &RekeyAllOptions{}
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("Need at least one recipient.")
+	}
+	identities, err := parseIdentitiesFile(oldIdentity, s.PassphraseProvider())
+	if err != nil {
+		return nil, err
+	}
+	typ := "IDENTITY"
+	if isScrypt(recipients) {
+		typ = "SCRYPT"
+	}
+	names := recordedRecipients(recipients)
+
+	journal, err := readRekeyJournal(opts.Journal)
+	if err != nil {
+		return nil, err
+	}
+	var jf *os.File
+	if len(opts.Journal) > 0 {
+		jf, err = os.OpenFile(opts.Journal, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		defer jf.Close()
+	}
+
+	report := &RekeyReport{StartedAt: time.Now().UTC(), Recipients: names}
+	err = s.update(func() error {
+		recovery, recoveryNames, err := s.recoveryRecipients()
+		if err != nil {
+			return err
+		}
+		rk := &rekeyer{
+			identities:    identities,
+			recipients:    recipients,
+			typ:           typ,
+			names:         names,
+			recovery:      recovery,
+			recoveryNames: recoveryNames,
+			named:         opts.NamedRecipients,
+			journal:       journal,
+			jf:            jf,
+		}
+		report.Results = nil
+		for i, w := range s.wallets {
+			res := rk.rekeyAccount(w)
+			report.Results = append(report.Results, res)
+			if opts.Progress != nil {
+				opts.Progress(i+1, len(s.wallets), res)
+			}
+		}
+		if jf != nil {
+			return jf.Sync()
+		}
+		return nil
+	})
+	report.FinishedAt = time.Now().UTC()
+	if err != nil {
+		return report, err
+	}
+	if jf != nil {
+		jf.Close()
+		os.Remove(opts.Journal)
+	}
+	return report, nil
+}
+
+// rekeyer re-encrypts the accounts of a RekeyAll run.
+type rekeyer struct {
+	identities    []age.Identity
+	recipients    []age.Recipient
+	typ           string
+	names         []string
+	recovery      []age.Recipient
+	recoveryNames []string
+	named         []string
+	journal       map[string]*rekeyJournalEntry
+	jf            *os.File
+}
+
+// rekeyAccount re-encrypts w, taking it from the journal if it was done
+// before.
+func (rk *rekeyer) rekeyAccount(w *Wallet) RekeyResult {
+	res := RekeyResult{ID: w.ID, Address: w.Address()}
+	old := armorHash(w.Armor)
+
+	if e, ok := rk.journal[old]; ok && len(rk.names) > 0 && e.ID == w.ID && sameRecipients(e.Recipients, rk.names) && (e.Type == rk.typ || e.Type == "TWOFACTOR") {
+		w.Type, w.Armor, w.RecoveryArmor, w.Recovery, w.Recipients = e.Type, e.Armor, e.RecoveryArmor, e.Recovery, e.Recipients
+		w.NamedRecipients, w.KDF = e.Named, e.KDF
+		res.Status, res.Resumed = RekeyStatusRekeyed, true
+		return res
+	}
+
+	entry := &rekeyJournalEntry{
+		ID:         w.ID,
+		OldArmor:   old,
+		Type:       rk.typ,
+		Recipients: rk.names,
+		Named:      rk.named,
+	}
+	var err error
+	switch strings.ToLower(w.Type) {
+	case "identity":
+		var account *nkn.Account
+		account, err = decryptAccountByIdentities(w, rk.identities)
+		if err == nil && account.WalletAddress() != w.Address() {
+			err = errors.New("decrypted account does not match the address")
+		}
+		if err == nil {
+			var enc *encryptedAccount
+			enc, err = encryptAccountWithRecovery(account, rk.recipients, rk.recovery, rk.recoveryNames)
+			if err == nil {
+				entry.Armor, entry.RecoveryArmor, entry.Recovery, entry.KDF = enc.armor, enc.recoveryArmor, enc.recovery, enc.kdf
+			}
+		}
+	case "twofactor":
+		// only the outer layer is replaced, the passphrase and the recovery
+		// armor stay
+		if isScrypt(rk.recipients) {
+			res.Status, res.Reason = RekeyStatusFailed, "two-factor account can't be re-encrypted to a passphrase"
+			return res
+		}
+		var inner, armor []byte
+		inner, err = unwrapTwoFactor(w, rk.identities)
+		if err == nil {
+			armor, err = wrapTwoFactor(inner, rk.recipients)
+		}
+		entry.Type, entry.Armor, entry.RecoveryArmor, entry.Recovery, entry.KDF = "TWOFACTOR", string(armor), w.RecoveryArmor, w.Recovery, w.KDF
+	case "watch":
+		res.Status, res.Reason = RekeyStatusSkipped, "account is watch-only"
+		return res
+	case "external":
+		res.Status, res.Reason = RekeyStatusSkipped, "account signs with an external signer"
+		return res
+	default:
+		res.Status, res.Reason = RekeyStatusSkipped, "account is not encrypted to an identity"
+		return res
+	}
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		res.Status, res.Reason = RekeyStatusSkipped, "account is not encrypted to the old identity"
+		return res
+	}
+	if err != nil {
+		res.Status, res.Reason = RekeyStatusFailed, err.Error()
+		return res
+	}
+
+	if rk.jf != nil && len(rk.names) > 0 {
+		dat, err := json.Marshal(entry)
+		if err == nil {
+			_, err = rk.jf.Write(append(dat, '\n'))
+		}
+		if err != nil {
+			res.Status, res.Reason = RekeyStatusFailed, err.Error()
+			return res
+		}
+	}
+
+	w.Type, w.Armor, w.RecoveryArmor, w.Recovery, w.Recipients = entry.Type, entry.Armor, entry.RecoveryArmor, entry.Recovery, entry.Recipients
+	w.NamedRecipients, w.KDF = entry.Named, entry.KDF
+	res.Status = RekeyStatusRekeyed
+	return res
+}
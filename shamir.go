@@ -0,0 +1,230 @@
+package nknwallet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// shareHeaderSize is the size of the header of an encoded share: the 2 byte
+// set ID, the threshold and the x coordinate.
+const shareHeaderSize = 4
+
+// Share is one share of a secret split with SplitSecret. Any Threshold shares
+// of the same set rebuild the secret.
+type Share struct {
+	// SetID identifies the shares created by one split, so shares of
+	// different splits are not combined by accident.
+	SetID     uint16
+	Threshold int
+	X         byte
+	Y         []byte
+}
+
+// gfMul multiplies a and b in GF(2^8) with the polynomial of AES
+// (x^8 + x^4 + x^3 + x + 1).
+func gfMul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns the multiplicative inverse of a != 0 in GF(2^8), a^254.
+func gfInv(a byte) byte {
+	r, e := byte(1), 254
+	for e > 0 {
+		if e&1 != 0 {
+			r = gfMul(r, a)
+		}
+		a = gfMul(a, a)
+		e >>= 1
+	}
+	return r
+}
+
+// SplitSecret splits secret into n shares of which any k rebuild it, using
+// Shamir's secret sharing over GF(2^8) byte by byte. The length of secret
+// must be a multiple of 4 so shares can be encoded as mnemonic.
+func SplitSecret(secret []byte, n, k int) ([]*Share, error) {
+	if len(secret) == 0 || len(secret)%4 != 0 {
+		return nil, errors.New("secret length must be a multiple of 4 bytes")
+	}
+	if k < 1 || k > n || n > 255 {
+		return nil, fmt.Errorf("invalid threshold %d of %d shares (need 1 <= threshold <= shares <= 255)", k, n)
+	}
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	shares := make([]*Share, n)
+	for i := range shares {
+		shares[i] = &Share{
+			SetID:     binary.BigEndian.Uint16(id[:]),
+			Threshold: k,
+			X:         byte(i + 1),
+			Y:         make([]byte, len(secret)),
+		}
+	}
+
+	// one random polynomial of degree k-1 per byte with the secret byte as
+	// constant term
+	coeffs := make([]byte, k)
+	for b, c := range secret {
+		coeffs[0] = c
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for _, sh := range shares {
+			// Horner's method
+			var y byte
+			for j := k - 1; j >= 0; j-- {
+				y = gfMul(y, sh.X) ^ coeffs[j]
+			}
+			sh.Y[b] = y
+		}
+	}
+	for i := range coeffs {
+		coeffs[i] = 0
+	}
+	return shares, nil
+}
+
+// CombineShares rebuilds the secret from at least Threshold shares of the same
+// set.
+func CombineShares(shares []*Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+	first := shares[0]
+	seen := map[byte]bool{}
+	var use []*Share
+	for _, sh := range shares {
+		if sh.SetID != first.SetID || sh.Threshold != first.Threshold || len(sh.Y) != len(first.Y) {
+			return nil, errors.New("Shares belong to different splits.")
+		}
+		if sh.X == 0 {
+			return nil, errors.New("invalid share")
+		}
+		if seen[sh.X] {
+			continue
+		}
+		seen[sh.X] = true
+		use = append(use, sh)
+	}
+	if len(use) < first.Threshold {
+		return nil, fmt.Errorf("Need %d different shares, got %d.", first.Threshold, len(use))
+	}
+	use = use[:first.Threshold]
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, len(first.Y))
+	for i, si := range use {
+		basis := byte(1)
+		for j, sj := range use {
+			if i != j {
+				basis = gfMul(basis, gfMul(sj.X, gfInv(sj.X^si.X)))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(si.Y[b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// Mnemonic encodes the share as BIP39 words with checksum. A share of a 32
+// byte seed is 27 words long.
+func (sh *Share) Mnemonic() (string, error) {
+	if sh.Threshold < 1 || sh.Threshold > 255 {
+		return "", errors.New("invalid share threshold")
+	}
+	dat := make([]byte, shareHeaderSize, shareHeaderSize+len(sh.Y))
+	binary.BigEndian.PutUint16(dat, sh.SetID)
+	dat[2] = byte(sh.Threshold)
+	dat[3] = sh.X
+	dat = append(dat, sh.Y...)
+
+	words, err := entropyToWords(dat)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(words, " "), nil
+}
+
+// ParseShare decodes a share encoded by Share.Mnemonic and verifies its
+// checksum. Words may be abbreviated to unique prefixes.
+func ParseShare(mnemonic string) (*Share, error) {
+	dat, err := wordsToEntropy(strings.Fields(mnemonic))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) <= shareHeaderSize || dat[2] == 0 || dat[3] == 0 {
+		return nil, errors.New("not a valid share")
+	}
+	return &Share{
+		SetID:     binary.BigEndian.Uint16(dat),
+		Threshold: int(dat[2]),
+		X:         dat[3],
+		Y:         dat[shareHeaderSize:],
+	}, nil
+}
+
+// EncryptShare returns the mnemonic of the share age encrypted to recipients.
+func EncryptShare(sh *Share, recipients []age.Recipient) (string, error) {
+	mnemonic, err := sh.Mnemonic()
+	if err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	if err := encrypt(recipients, strings.NewReader(mnemonic+"\n"), out); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// DecryptShareByIdentity decrypts a share encrypted by EncryptShare with the
+// identities of the identity files and returns the first one that works.
+func DecryptShareByIdentity(armor string, pp PassphraseProvider, identityFiles ...string) (*Share, error) {
+	var identities []age.Identity
+	for _, f := range identityFiles {
+		ids, err := parseIdentitiesFile(f, pp)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, ids...)
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("Share is encrypted. Use an identity file to decrypt it.")
+	}
+
+	out := &bytes.Buffer{}
+	if err := decrypt(identities, strings.NewReader(armor), out); err != nil {
+		return nil, err
+	}
+	return ParseShare(out.String())
+}
+
+// Shares splits the seed of the wallet into n shares of which any k rebuild
+// it. The wallet must have been decrypted.
+func (w *Wallet) Shares(n, k int) ([]*Share, error) {
+	if w.Account() == nil {
+		return nil, ErrSeedUnavailable
+	}
+	return SplitSecret(w.Seed(), n, k)
+}
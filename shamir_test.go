@@ -0,0 +1,135 @@
+package nknwallet
+
+import (
+	"bytes"
+	"testing"
+)
+
+// subsets calls fn with every subset of k of the n indices 0..n-1.
+func subsets(n, k int, fn func([]int)) {
+	var rec func(start int, picked []int)
+	rec = func(start int, picked []int) {
+		if len(picked) == k {
+			fn(picked)
+			return
+		}
+		for i := start; i < n; i++ {
+			rec(i+1, append(picked, i))
+		}
+	}
+	rec(0, nil)
+}
+
+func TestSplitSecretCombineShares(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x00, 0x01, 0x80, 0xff}, 8)
+	for _, nk := range [][2]int{{1, 1}, {3, 2}, {5, 3}, {5, 5}, {7, 4}} {
+		n, k := nk[0], nk[1]
+		shares, err := SplitSecret(secret, n, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shares) != n {
+			t.Fatalf("SplitSecret(%d, %d) returned %d shares", n, k, len(shares))
+		}
+		for size := 1; size <= n; size++ {
+			subsets(n, size, func(picked []int) {
+				var use []*Share
+				for _, i := range picked {
+					use = append(use, shares[i])
+				}
+				got, err := CombineShares(use)
+				if size < k {
+					if err == nil {
+						t.Errorf("%d-of-%d: CombineShares of shares %v succeeded", k, n, picked)
+					}
+					return
+				}
+				if err != nil || !bytes.Equal(got, secret) {
+					t.Errorf("%d-of-%d: CombineShares of shares %v = %x, %v", k, n, picked, got, err)
+				}
+			})
+		}
+	}
+}
+
+func TestSplitSecretInvalid(t *testing.T) {
+	secret := make([]byte, 32)
+	for _, nk := range [][2]int{{3, 0}, {3, 4}, {256, 2}} {
+		if _, err := SplitSecret(secret, nk[0], nk[1]); err == nil {
+			t.Errorf("SplitSecret(%d, %d) succeeded", nk[0], nk[1])
+		}
+	}
+	for _, size := range []int{0, 31} {
+		if _, err := SplitSecret(make([]byte, size), 3, 2); err == nil {
+			t.Errorf("SplitSecret of a %d byte secret succeeded", size)
+		}
+	}
+}
+
+func TestCombineSharesRejects(t *testing.T) {
+	secret := make([]byte, 32)
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other[1].SetID = shares[0].SetID + 1
+
+	tests := []struct {
+		name   string
+		shares []*Share
+	}{
+		{"none", nil},
+		{"fewer than threshold", shares[:2]},
+		{"duplicate share", []*Share{shares[0], shares[1], shares[1]}},
+		{"same share three times", []*Share{shares[2], shares[2], shares[2]}},
+		{"different splits", []*Share{shares[0], shares[1], other[1]}},
+	}
+	for _, tt := range tests {
+		if _, err := CombineShares(tt.shares); err == nil {
+			t.Errorf("CombineShares of %s succeeded", tt.name)
+		}
+	}
+}
+
+func TestShareMnemonic(t *testing.T) {
+	secret := bytes.Repeat([]byte{0xa5}, 32)
+	shares, err := SplitSecret(secret, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed []*Share
+	for _, sh := range shares {
+		mnemonic, err := sh.Mnemonic()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if words := len(bytes.Fields([]byte(mnemonic))); words != 27 {
+			t.Fatalf("share mnemonic has %d words, want 27", words)
+		}
+		p, err := ParseShare(mnemonic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.SetID != sh.SetID || p.Threshold != sh.Threshold || p.X != sh.X || !bytes.Equal(p.Y, sh.Y) {
+			t.Fatalf("ParseShare = %+v, want %+v", p, sh)
+		}
+		parsed = append(parsed, p)
+	}
+	got, err := CombineShares(parsed[1:])
+	if err != nil || !bytes.Equal(got, secret) {
+		t.Fatalf("CombineShares of parsed shares = %x, %v", got, err)
+	}
+
+	// a seed mnemonic is not a share
+	mnemonic, err := SeedToMnemonic(make([]byte, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseShare(mnemonic); err == nil {
+		t.Fatal("ParseShare of a mnemonic without share header succeeded")
+	}
+}
@@ -0,0 +1,292 @@
+package nknwallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nknorg/nkn-sdk-go"
+	"github.com/nknorg/nkn/v2/common"
+	"github.com/nknorg/nkn/v2/program"
+	"github.com/nknorg/nkn/v2/signature"
+	"github.com/nknorg/nkn/v2/transaction"
+)
+
+// A Wallet signs transactions through a Signer: the decrypted account itself,
+// an agent holding it, or an external signer keeping the key elsewhere, e.g.
+// an HSM bridge, a privileged process or another machine.
+//
+// EXTERNAL accounts record the command of their external signer. The command
+// is run for every request, reads one JSON request line on stdin and writes
+// one JSON response line on stdout:
+//
+//	{"version":1,"op":"pubkey","address":"NKN..."}
+//	{"pubkey":"<hex>"}
+//
+//	{"version":1,"op":"sign","address":"NKN...","tx":"<hex>"}
+//	{"signature":"<hex>"}
+//
+// The address is empty when an account is added without one; the signer then
+// answers with the public key of its default account. tx is the protobuf
+// encoded unsigned transaction. Failures are reported as {"error":"..."}.
+
+// SignerProtocolVersion is the version of the external signer protocol.
+const SignerProtocolVersion = 1
+
+// commandSignerTimeout bounds a request to an external signer, which may wait
+// for the user, e.g. to touch a hardware key.
+const commandSignerTimeout = 2 * time.Minute
+
+// Signer signs transactions for one account.
+type Signer interface {
+	// PubKey returns the public key of the account.
+	PubKey() []byte
+	// Sign returns the signature of the unsigned tx.
+	Sign(tx *transaction.Transaction) ([]byte, error)
+}
+
+// LocalSigner signs with a decrypted account.
+type LocalSigner struct {
+	account *nkn.Account
+}
+
+// NewLocalSigner returns a signer signing with account.
+func NewLocalSigner(account *nkn.Account) *LocalSigner {
+	return &LocalSigner{account: account}
+}
+
+// PubKey implements Signer.
+func (s *LocalSigner) PubKey() []byte {
+	return s.account.PubKey()
+}
+
+// Sign implements Signer.
+func (s *LocalSigner) Sign(tx *transaction.Transaction) ([]byte, error) {
+	return signature.SignBySigner(tx, s.account.Account)
+}
+
+// SignerConfig records the external signer of an EXTERNAL account.
+type SignerConfig struct {
+	// Command is the signer program, looked up in PATH unless it contains
+	// a slash.
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+func (c SignerConfig) String() string {
+	return strings.Join(append([]string{c.Command}, c.Args...), " ")
+}
+
+// CommandSigner signs by running an external signer command.
+type CommandSigner struct {
+	config  SignerConfig
+	address string
+	pubKey  []byte
+}
+
+type signerRequest struct {
+	Version int    `json:"version"`
+	Op      string `json:"op"`
+	Address string `json:"address"`
+	Tx      string `json:"tx,omitempty"`
+}
+
+type signerResponse struct {
+	PubKey    string `json:"pubkey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NewCommandSigner returns a signer for the account with address, asking the
+// external signer of config for its public key. If address is empty the
+// default account of the signer is used.
+func NewCommandSigner(config SignerConfig, address string) (*CommandSigner, error) {
+	if len(config.Command) == 0 {
+		return nil, errors.New("Signer command is empty.")
+	}
+	s := &CommandSigner{config: config, address: address}
+	resp, err := s.call(signerRequest{Op: "pubkey"})
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := hex.DecodeString(resp.PubKey)
+	if err != nil || len(pubKey) == 0 {
+		return nil, errors.New("Signer returned an invalid public key.")
+	}
+	a, err := pubKeyToAddress(pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("Signer returned an invalid public key: %v", err)
+	}
+	if len(address) > 0 && a != address {
+		return nil, fmt.Errorf("Public key of the signer does not belong to %s.", address)
+	}
+	s.address, s.pubKey = a, pubKey
+	return s, nil
+}
+
+// Address returns the address of the account the signer signs for.
+func (s *CommandSigner) Address() string {
+	return s.address
+}
+
+// Config returns the external signer of s.
+func (s *CommandSigner) Config() SignerConfig {
+	return s.config
+}
+
+// PubKey implements Signer.
+func (s *CommandSigner) PubKey() []byte {
+	return s.pubKey
+}
+
+// Sign implements Signer.
+func (s *CommandSigner) Sign(tx *transaction.Transaction) ([]byte, error) {
+	dat, err := tx.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.call(signerRequest{Op: "sign", Tx: hex.EncodeToString(dat)})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := hex.DecodeString(resp.Signature)
+	if err != nil || len(sig) == 0 {
+		return nil, errors.New("Signer returned an invalid signature.")
+	}
+	return sig, nil
+}
+
+func (s *CommandSigner) call(req signerRequest) (*signerResponse, error) {
+	req.Version = SignerProtocolVersion
+	req.Address = s.address
+	dat, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandSignerTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.config.Command, s.config.Args...)
+	cmd.Stdin = bytes.NewReader(append(dat, '\n'))
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return nil, fmt.Errorf("Signer failed: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("Signer failed: %v", err)
+	}
+
+	var resp signerResponse
+	if err := json.Unmarshal([]byte(firstLine(out)), &resp); err != nil {
+		return nil, fmt.Errorf("Could not read response of signer: %v", err)
+	}
+	if len(resp.Error) > 0 {
+		return nil, fmt.Errorf("Signer: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+func pubKeyToAddress(pubKey []byte) (string, error) {
+	programHash, err := program.CreateProgramHash(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return programHash.ToAddress()
+}
+
+// ExternalSignerError is returned when an EXTERNAL account is asked to be
+// decrypted.
+type ExternalSignerError struct {
+	Address string
+}
+
+func (e ExternalSignerError) Error() string {
+	return fmt.Sprintf("Account %s signs with an external signer. The wallet holds no key for it.", e.Address)
+}
+
+// IsExternal reports whether the account is an EXTERNAL account.
+func (w *Wallet) IsExternal() bool {
+	return strings.ToLower(w.Type) == "external"
+}
+
+// AddExternal adds an EXTERNAL account signing with the external signer of
+// config to the store. If address is empty the default account of the signer
+// is added.
+func (s *Store) AddExternal(config SignerConfig, address, alias string) (*Wallet, error) {
+	if len(address) > 0 {
+		if _, err := common.ToScriptHash(address); err != nil {
+			return nil, fmt.Errorf("Invalid NKN address %s.", address)
+		}
+	}
+	signer, err := NewCommandSigner(config, address)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Wallet{
+		ID:             s.getNextID(),
+		Type:           "EXTERNAL",
+		NKNAddress:     signer.Address(),
+		Alias:          alias,
+		PublicKey:      hex.EncodeToString(signer.PubKey()),
+		ExternalSigner: &config,
+	}
+	if err := s.SaveWallet(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewExternalWallet returns the EXTERNAL account with index signing with its
+// external signer.
+func (s *Store) NewExternalWallet(index int, config *nkn.WalletConfig) (*Wallet, error) {
+	w, err := s.GetWalletByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	if !w.IsExternal() || w.ExternalSigner == nil {
+		return nil, fmt.Errorf("Account %d has no external signer.", index)
+	}
+	signer, err := NewCommandSigner(*w.ExternalSigner, w.Address())
+	if err != nil {
+		return nil, err
+	}
+	return s.NewWalletBySigner(signer, index, config)
+}
+
+// NewWalletBySigner returns the account with index signing with signer
+// instead of being decrypted. Its seed is not available.
+func (s *Store) NewWalletBySigner(signer Signer, index int, config *nkn.WalletConfig) (*Wallet, error) {
+	w, err := s.GetWalletByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	if w.IsWatchOnly() {
+		return nil, WatchOnlyError{w.Address()}
+	}
+	if address, err := pubKeyToAddress(signer.PubKey()); err != nil || address != w.Address() {
+		return nil, errors.New("Public key of the signer does not match the address.")
+	}
+	if w.config, err = nkn.MergeWalletConfig(config); err != nil {
+		return nil, err
+	}
+	w.signer = signer
+	return w, nil
+}
+
+// Signer returns the signer of the account: the one it was opened with, or
+// the decrypted account itself. It is nil if the account can't sign.
+func (w *Wallet) Signer() Signer {
+	if w.account != nil {
+		return NewLocalSigner(w.account)
+	}
+	return w.signer
+}
@@ -0,0 +1,211 @@
+package nknwallet
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nknorg/nkn-sdk-go"
+	"github.com/nknorg/nkn/v2/signature"
+	"github.com/nknorg/nkn/v2/transaction"
+)
+
+func init() {
+	helpers["signer"] = fakeSigner
+}
+
+// fakeSigner is an external signer for the account of the seed given as
+// hex argument. It ignores the address of requests, so the wallet has to
+// check the answers. With "error <message>" as arguments it fails every
+// request with message.
+func fakeSigner() int {
+	respond := func(resp signerResponse) int {
+		if err := json.NewEncoder(os.Stdout).Encode(resp); err != nil {
+			return 1
+		}
+		return 0
+	}
+	if len(os.Args) == 3 && os.Args[1] == "error" {
+		return respond(signerResponse{Error: os.Args[2]})
+	}
+	if len(os.Args) != 2 {
+		return 2
+	}
+	seed, err := hex.DecodeString(os.Args[1])
+	if err != nil {
+		return 2
+	}
+	account, err := nkn.NewAccount(seed)
+	if err != nil {
+		return 2
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return 2
+	}
+	var req signerRequest
+	if err := json.Unmarshal([]byte(line), &req); err != nil || req.Version != SignerProtocolVersion {
+		return respond(signerResponse{Error: "bad request"})
+	}
+	switch req.Op {
+	case "pubkey":
+		return respond(signerResponse{PubKey: hex.EncodeToString(account.PubKey())})
+	case "sign":
+		dat, err := hex.DecodeString(req.Tx)
+		if err != nil {
+			return respond(signerResponse{Error: "bad transaction"})
+		}
+		tx := &transaction.Transaction{}
+		if err := tx.Unmarshal(dat); err != nil {
+			return respond(signerResponse{Error: "bad transaction"})
+		}
+		sig, err := signature.SignBySigner(tx, account.Account)
+		if err != nil {
+			return respond(signerResponse{Error: err.Error()})
+		}
+		return respond(signerResponse{Signature: hex.EncodeToString(sig)})
+	}
+	return respond(signerResponse{Error: "unknown op " + req.Op})
+}
+
+// fakeSignerConfig returns the config of fakeSigner for a new account.
+func fakeSignerConfig(t *testing.T) (SignerConfig, *nkn.Account) {
+	t.Helper()
+	account, err := nkn.NewAccount(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := writeHelper(t, t.TempDir(), "signer", "signer")
+	return SignerConfig{Command: command, Args: []string{hex.EncodeToString(account.Seed())}}, account
+}
+
+func TestExternalSigner(t *testing.T) {
+	config, account := fakeSignerConfig(t)
+	s, err := NewStore("", WithBackend(NewMemBackend()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := s.AddExternal(config, "", "hsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Address() != account.WalletAddress() || added.PublicKey != hex.EncodeToString(account.PubKey()) {
+		t.Fatalf("external account is %s with public key %s, want the account of the signer", added.Address(), added.PublicKey)
+	}
+	if _, err := s.DecryptWallet(added.ID, AccountKey{}, nil); err == nil {
+		t.Fatal("external account was decrypted")
+	}
+
+	w, err := s.NewExternalWallet(added.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := nkn.NewAccount(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := transaction.NewTransferAssetTransaction(w.ProgramHash(), recipient.ProgramHash, 1, 100000000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SignTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.VerifySignature(); err != nil {
+		t.Fatalf("transaction signed by the external signer doesn't verify: %v", err)
+	}
+}
+
+func TestExternalSignerAddressMismatch(t *testing.T) {
+	config, _ := fakeSignerConfig(t)
+	other, err := nkn.NewAccount(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore("", WithBackend(NewMemBackend()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddExternal(config, other.WalletAddress(), ""); err == nil {
+		t.Fatal("AddExternal with an address the signer doesn't hold succeeded")
+	}
+
+	// the signer recorded with an account changes its key
+	w, err := s.AddExternal(config, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Args = []string{hex.EncodeToString(other.Seed())}
+	w.ExternalSigner = &config
+	if _, err := s.NewExternalWallet(w.ID, nil); err == nil {
+		t.Fatal("NewExternalWallet with a signer of another account succeeded")
+	}
+	if _, err := s.NewWalletBySigner(NewLocalSigner(other), w.ID, nil); err == nil {
+		t.Fatal("NewWalletBySigner with a signer of another account succeeded")
+	}
+}
+
+func TestExternalSignerError(t *testing.T) {
+	config, _ := fakeSignerConfig(t)
+	config.Args = []string{"error", "device locked"}
+	s, err := NewStore("", WithBackend(NewMemBackend()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AddExternal(config, "", "")
+	if err == nil || !strings.Contains(err.Error(), "device locked") {
+		t.Fatalf("AddExternal with a failing signer = %v, want its error", err)
+	}
+	if len(s.GetWallets()) != 0 {
+		t.Fatal("account of a failing signer was saved")
+	}
+}
+
+func TestSignerWalletHasNoSeed(t *testing.T) {
+	config, account := fakeSignerConfig(t)
+	s, err := NewStore("", WithBackend(NewMemBackend()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := s.AddExternal(config, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	external, err := s.NewExternalWallet(added.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := s.NewWalletBySigner(NewLocalSigner(account), added.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, w := range map[string]*Wallet{"external": external, "signer": local} {
+		t.Run(name, func(t *testing.T) {
+			if seed := w.Seed(); seed != nil {
+				t.Fatalf("Seed() = %x, want nil", seed)
+			}
+			if seed := w.ShowSeed(); seed != "" {
+				t.Fatalf("ShowSeed() = %q, want empty", seed)
+			}
+			if _, err := w.Mnemonic(); !errors.Is(err, ErrSeedUnavailable) {
+				t.Fatalf("Mnemonic() = %v, want ErrSeedUnavailable", err)
+			}
+			if _, err := w.Shares(3, 2); !errors.Is(err, ErrSeedUnavailable) {
+				t.Fatalf("Shares() = %v, want ErrSeedUnavailable", err)
+			}
+			if _, err := w.NewNanoPay(account.WalletAddress(), "0", 100); !errors.Is(err, ErrSeedUnavailable) {
+				t.Fatalf("NewNanoPay() = %v, want ErrSeedUnavailable", err)
+			}
+			if _, err := w.NewNanoPayClaimer("", 1000, 1000, "0", nil); !errors.Is(err, ErrSeedUnavailable) {
+				t.Fatalf("NewNanoPayClaimer() = %v, want ErrSeedUnavailable", err)
+			}
+		})
+	}
+}
@@ -3,13 +3,11 @@ package nknwallet
 import (
 	"context"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"io"
-	"io/ioutil"
 	"os"
-	"strings"
 	"sync"
+	"time"
 
 	"filippo.io/age"
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -17,61 +15,210 @@ import (
 	"github.com/nknorg/nkn/v2/common"
 	"github.com/nknorg/nkn/v2/pb"
 	"github.com/nknorg/nkn/v2/program"
-	"github.com/nknorg/nkn/v2/signature"
 	"github.com/nknorg/nkn/v2/transaction"
-	"github.com/nknorg/nkn/v2/util/password"
 )
 
 type Wallet struct {
 	ID         int    `json:"id"`
 	Type       string `json:"type"`
 	NKNAddress string `json:"address"`
-	Armor      string `json:"armor"`
+	Armor      string `json:"armor,omitempty"`
 	Alias      string `json:"alias,omitempty"`
+	// Path is the derivation path of an account derived from the master
+	// secret of the store.
+	Path string `json:"path,omitempty"`
+	// Recipients are the recipients the armor of an IDENTITY account is
+	// encrypted to, if known.
+	Recipients []string `json:"recipients,omitempty"`
+	// RecoveryArmor is the seed of a SCRYPT or TWOFACTOR account encrypted
+	// to the recovery recipients of the store.
+	RecoveryArmor string `json:"recovery_armor,omitempty"`
+	// Recovery are the recovery recipients the account is encrypted to.
+	Recovery []string `json:"recovery,omitempty"`
+	// NamedRecipients are the names of the recipient registry of the store
+	// the account is encrypted to. Its recipients are rebuilt from them when
+	// a name changes.
+	NamedRecipients []string `json:"named_recipients,omitempty"`
+	// KDF is how the key of a SCRYPT or TWOFACTOR account is derived from
+	// its passphrase.
+	KDF *KDF `json:"kdf,omitempty"`
+	// PublicKey is the hex encoded public key of a WATCH account, if known,
+	// or of an EXTERNAL account.
+	PublicKey string `json:"public_key,omitempty"`
+	// ExternalSigner is the external signer of an EXTERNAL account.
+	ExternalSigner *SignerConfig `json:"signer,omitempty"`
 
 	config  *nkn.WalletConfig
 	lock    sync.Mutex
 	account *nkn.Account
+	// inner is the passphrase encrypted armor of a decrypted TWOFACTOR
+	// account, which allows to change its recipients without passphrase.
+	inner []byte
+	// signer signs for an account that is not decrypted, e.g. one held by
+	// an agent, see NewWalletBySigner.
+	signer Signer
 }
 
 type Store struct {
-	wallets []*Wallet
-	path    string
+	mu          sync.RWMutex
+	header      StoreHeader
+	wallets     []*Wallet
+	backend     Backend
+	backups     int
+	lockTimeout time.Duration
+	metadataKey *MetadataKey
+	passphrase  PassphraseProvider
+	// scryptWorkFactor overrides the scrypt work factor of the store
+	scryptWorkFactor int
+	// keyServer overrides the key server of the store
+	keyServer string
+
+	// metadataPassphraseKey opens metadata sealed with a passphrase, see
+	// passphraseMetadataKey
+	metadataPassphraseKey *MetadataKey
+	// cache of the last sealed accounts, see unsealAccounts
+	sealed   string
+	unsealed []byte
+}
+
+// StoreOption configures a Store created by NewStore.
+type StoreOption func(s *Store)
+
+// WithBackend makes the store use b instead of the backend derived from the
+// path passed to NewStore.
+func WithBackend(b Backend) StoreOption {
+	return func(s *Store) {
+		s.backend = b
+	}
+}
+
+// WithBackups sets the number of backup generations kept next to the wallet
+// file. Zero disables backups. It has no effect together with WithBackend.
+func WithBackups(n int) StoreOption {
+	return func(s *Store) {
+		s.backups = n
+	}
 }
 
-func NewStore(path string) (*Store, error) {
-	if len(path) == 0 {
-		return nil, errors.New("Need a file path for the wallet.")
+// WithLockTimeout sets how long the store waits for the lock of the backend
+// held by another process. Zero waits indefinitely.
+func WithLockTimeout(timeout time.Duration) StoreOption {
+	return func(s *Store) {
+		s.lockTimeout = timeout
+	}
+}
+
+// NewStore opens the wallet at path, which is a file path or a location
+// understood by OpenBackend.
+func NewStore(path string, opts ...StoreOption) (*Store, error) {
+	s := &Store{
+		backups:     DefaultBackups,
+		lockTimeout: DefaultLockTimeout,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.backend == nil {
+		b, err := OpenBackend(path, s.backups)
+		if err != nil {
+			return nil, err
+		}
+		s.backend = b
 	}
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+
+	migrated, err := s.load()
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	if migrated {
+		// upgrade the wallet file in place
+		if err := s.update(func() error { return nil }); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// load reads the store from the backend under a shared lock.
+func (s *Store) load() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	dat, err := io.ReadAll(f)
+	unlock, err := s.backend.Lock(false, s.lockTimeout)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
+	defer unlock()
+
+	return s.reload()
+}
 
-	var wallets []*Wallet
-	if len(dat) > 0 {
-		err = json.Unmarshal(dat, &wallets)
+// reload reads the store from the backend and reports whether it was
+// migrated from an older format. The caller must hold the backend lock.
+func (s *Store) reload() (bool, error) {
+	e, err := s.backend.Load()
+	if err != nil {
+		return false, err
+	}
+	migrated, err := migrateEnvelope(e)
+	if err != nil {
+		return false, err
+	}
+	if len(e.Sealed) > 0 {
+		e.Accounts, err = s.unsealAccounts(e.Sealed, e.Header.Settings)
 		if err != nil {
-			return nil, err
+			return false, err
 		}
 	}
+	s.header = e.Header
+	s.wallets = e.Accounts
+	return migrated, nil
+}
+
+// update applies fn to the store and saves it while holding an exclusive lock
+// on the backend. The store is reloaded first so that changes made by other
+// processes since NewStore are not overwritten.
+func (s *Store) update(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.backend.Lock(true, s.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := s.reload(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		s.reload()
+		return err
+	}
+	return nil
+}
+
+// Backend returns the backend the store is persisted to.
+func (s *Store) Backend() Backend {
+	return s.backend
+}
 
-	return &Store{
-		wallets: wallets,
-		path:    path,
-	}, nil
+// Header returns the store-level metadata of the wallet file.
+func (s *Store) Header() StoreHeader {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.header
 }
 
 func (s *Store) IsExistWalletByAlias(alias string) bool {
 	if len(alias) == 0 {
 		return false
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	for _, w := range s.wallets {
 		if w.Alias == alias {
 			return true
@@ -81,15 +228,14 @@ func (s *Store) IsExistWalletByAlias(alias string) bool {
 }
 
 func (s *Store) IsExistWalletByIndex(index int) bool {
-	for _, w := range s.wallets {
-		if w.ID == index {
-			return true
-		}
-	}
-	return false
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.findWallet(index) != nil
 }
 
 func (s *Store) GetWallets() []*Wallet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.wallets
 }
 
@@ -97,112 +243,84 @@ func (s *Store) GetWalletByIndex(index int) (*Wallet, error) {
 	if index == 0 {
 		return nil, errors.New("Index not set")
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if w := s.findWallet(index); w != nil {
+		return w, nil
+	}
+	return nil, errors.New("Wallet not found")
+}
+
+// findWallet returns the wallet with the given ID or nil. The caller must hold
+// s.mu.
+func (s *Store) findWallet(id int) *Wallet {
 	for _, w := range s.wallets {
-		if w.ID == index {
-			return w, nil
+		if w.ID == id {
+			return w
 		}
 	}
-	return nil, errors.New("Wallet not found")
+	return nil
 }
 
 func (s *Store) SetAlias(wallet *Wallet, alias string) error {
-	for i, w := range s.wallets {
-		if w.ID == wallet.ID {
-			s.wallets[i].Alias = alias
-			s.save()
-			return nil
+	return s.update(func() error {
+		w := s.findWallet(wallet.ID)
+		if w == nil {
+			return errors.New("Could not find wallet.")
 		}
-	}
-	return errors.New("Could not find wallet.")
+		w.Alias = alias
+		wallet.Alias = alias
+		return nil
+	})
 }
 
+// RestoreFromSeedByIdentity encrypts seed to the recipients of the identity
+// file.
 func (s *Store) RestoreFromSeedByIdentity(seed []byte, identity string) (*Wallet, error) {
-	recipients, err := s.ParseIdentity(identity)
-	if err != nil {
-		return nil, err
-	}
-
-	account, err := nkn.NewAccount(seed)
-	if err != nil {
-		return nil, err
-	}
-
-	armor, err := encryptAccount(account, recipients)
-	if err != nil {
-		return nil, err
-	}
-
-	config, err := nkn.MergeWalletConfig(nil)
-	if err != nil {
-		return nil, err
-	}
+	return s.RestoreFromSeed("identity", seed, AccountKey{Identity: identity})
+}
 
-	w := &Wallet{
-		ID:         s.getNextID(),
-		Type:       "IDENTITY",
-		NKNAddress: account.WalletAddress(),
-		Armor:      string(armor),
-		Alias:      "",
-		config:     config,
-		lock:       sync.Mutex{},
-		account:    account,
-	}
-	return w, nil
+// RestoreFromSeedByRecipientFile encrypts seed to the recipients listed in
+// file.
+func (s *Store) RestoreFromSeedByRecipientFile(seed []byte, file string) (*Wallet, error) {
+	return s.RestoreFromSeed("recipient-file", seed, AccountKey{RecipientFile: file})
+}
 
+// RestoreFromSeedByRecipient encrypts seed to recipient.
+func (s *Store) RestoreFromSeedByRecipient(seed []byte, recipient string) (*Wallet, error) {
+	return s.RestoreFromSeed("recipient", seed, AccountKey{Recipient: recipient})
 }
 
+// RestoreFromSeedByPassword encrypts seed with a prompted passphrase.
 func (s *Store) RestoreFromSeedByPassword(seed []byte) (*Wallet, error) {
-	pass, err := passphrasePromptForEncryption()
-	if err != nil {
-		return nil, err
-	}
-
-	r, err := age.NewScryptRecipient(pass)
-	if err != nil {
-		return nil, err
-	}
-
-	account, err := nkn.NewAccount(seed)
-	if err != nil {
-		return nil, err
-	}
-
-	armor, err := encryptAccount(account, []age.Recipient{r})
-	if err != nil {
-		return nil, err
-	}
-
-	config, err := nkn.MergeWalletConfig(nil)
-	if err != nil {
-		return nil, err
-	}
+	return s.RestoreFromSeed("scrypt", seed, AccountKey{})
+}
 
-	w := &Wallet{
-		ID:         s.getNextID(),
-		Type:       "SCRYPT",
-		NKNAddress: account.WalletAddress(),
-		Armor:      string(armor),
-		Alias:      "",
-		config:     config,
-		lock:       sync.Mutex{},
-		account:    account,
+// RestoreFromSeedByPassphrase is like RestoreFromSeedByPassword, but uses the
+// given passphrase instead of prompting for one.
+func (s *Store) RestoreFromSeedByPassphrase(seed []byte, pass string) (*Wallet, error) {
+	if len(pass) == 0 {
+		return nil, errors.New("Passphrase is empty.")
 	}
-	return w, nil
-
+	return s.RestoreFromSeed("scrypt", seed, AccountKey{Passphrase: pass})
 }
 
 func (s *Store) PromptPassword(create bool) (string, error) {
 	if create {
-		return passphrasePromptForEncryption()
+		return newPassphrase(s.PassphraseProvider())
 	}
-	pass, err := password.GetPassword("")
-	if err != nil {
-		return "", err
-	}
-	return string(pass), nil
+	return s.PassphraseProvider().Passphrase(PassphraseRequest{Prompt: "Enter passphrase"})
+}
+
+// PromptChangedPassword asks for a passphrase replacing the current one of
+// accounts, e.g. when they are rekeyed to a passphrase.
+func (s *Store) PromptChangedPassword() (string, error) {
+	return changedPassphrase(s.PassphraseProvider())
 }
 
 func (s *Store) ListWallets() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if s.wallets == nil {
 		return errors.New("No wallet found or wallet has no accounts.")
 	}
@@ -211,288 +329,167 @@ func (s *Store) ListWallets() error {
 	t.Style().Options.DrawBorder = false
 	mw := io.MultiWriter(os.Stdout)
 	t.SetOutputMirror(mw)
-	t.AppendHeader(table.Row{"ID", "Alias", "Address"})
+	t.AppendHeader(table.Row{"ID", "Alias", "Address", "Type", "Protection"})
 
 	for _, w := range s.wallets {
-		t.AppendRow(table.Row{w.ID, w.Alias, w.Address()})
+		t.AppendRow(table.Row{w.ID, w.Alias, w.Address(), w.Type, w.Describe()})
 	}
 	t.Render()
 
 	return nil
 }
 
+// save writes the store to the backend. The caller must hold the exclusive
+// backend lock.
 func (s *Store) save() error {
-	if len(s.path) == 0 {
-		return errors.New("Wallet is missing file path information.")
+	s.header.Version = StoreFormatVersion
+	s.header.UpdatedAt = time.Now().UTC()
+	var sealed string
+	if s.header.Settings.EncryptMetadata {
+		var err error
+		if sealed, err = s.sealAccounts(s.wallets); err != nil {
+			return err
+		}
 	}
-
-	dat, err := json.Marshal(s.wallets)
-	if err != nil {
-		return err
+	e := &Envelope{
+		Header:   s.header,
+		Accounts: s.wallets,
+		Sealed:   sealed,
 	}
-	return ioutil.WriteFile(s.path, dat, 0644)
+	if len(sealed) > 0 {
+		e.Accounts = nil
+	}
+	return s.backend.Save(e)
 }
 
-func (s *Store) DeleteWalletByIndex(index int) {
-	var newwallets []*Wallet
-	for _, w := range s.wallets {
-		if w.ID != index {
-			newwallets = append(newwallets, w)
+func (s *Store) DeleteWalletByIndex(index int) error {
+	return s.update(func() error {
+		if s.findWallet(index) == nil {
+			return errors.New("Wallet not found")
 		}
-	}
-	s.wallets = newwallets
-	s.save()
+		var newwallets []*Wallet
+		for _, w := range s.wallets {
+			if w.ID != index {
+				newwallets = append(newwallets, w)
+			}
+		}
+		s.wallets = newwallets
+		return nil
+	})
 }
 
 func (s *Store) getNextID() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nextID()
+}
+
+// nextID returns the ID for a new wallet. The caller must hold s.mu.
+func (s *Store) nextID() int {
 	if s.wallets == nil {
 		return 1
 	}
 	return s.wallets[len(s.wallets)-1].ID + 1
 }
 
+// SetPassword protects the decrypted account with a new prompted passphrase.
+// Only SCRYPT and TWOFACTOR accounts have one.
 func (s *Store) SetPassword(wallet *Wallet) error {
-	for i, w := range s.wallets {
-		if w.ID == wallet.ID {
-			if strings.ToLower(w.Type) != "scrypt" {
-				return errors.New("Wallet is not an scrypt type. Can't change password.")
-			}
-			restored, err := s.RestoreFromSeedByPassword(w.Seed())
-			if err != nil {
-				return err
-			}
-			s.wallets[i] = restored
-			s.save()
-		}
-	}
+	return s.RekeyWallet(wallet, AccountKey{})
+}
 
-	return nil
+// Rekey re-encrypts the seed of the decrypted wallet to recipients, replacing
+// the recipients it was encrypted to before. A single scrypt recipient turns
+// the account into a SCRYPT account, any other recipients into an IDENTITY
+// account. A TWOFACTOR account stays one and keeps its passphrase unless it is
+// rekeyed to a passphrase. ID, alias and address of the account are kept, the
+// names of the recipient registry it was encrypted to are not.
+func (s *Store) Rekey(wallet *Wallet, recipients []age.Recipient) error {
+	return s.rekey(wallet, recipients, nil)
 }
 
-func (s *Store) getWalletByIndex(index int, identity string) (*Wallet, error) {
-	w, err := s.GetWalletByIndex(index)
-	if err != nil {
-		return nil, err
+func (s *Store) rekey(wallet *Wallet, recipients []age.Recipient, named []string) error {
+	if wallet.Account() == nil {
+		return errors.New("Wallet is not decrypted.")
 	}
-	if w == nil {
-		return nil, errors.New("could not get wallet")
+	if len(recipients) == 0 {
+		return errors.New("Need at least one recipient.")
 	}
-	// this check is ok because getWalletByIndex is only called from non-password paths
-	if strings.ToLower(w.Type) == "scrypt" {
-		return nil, errors.New("Wallet is an scrypt type. Use a password to decrypt it.")
-	}
-
-	var account *nkn.Account
 
-	switch strings.ToLower(w.Type) {
-	case "scrypt":
-		account, err = decryptAccountByPassword(w)
-	case "identity":
-		account, err = decryptAccountByIdentityFile(w, identity)
-	default:
-		return nil, errors.New("Wallet is missing type information.")
-	}
-	if err != nil {
-		return nil, err
-	}
-	if account == nil {
-		return nil, errors.New("Something went wrong.")
+	if wallet.Type == "TWOFACTOR" && wallet.inner != nil && !isScrypt(recipients) {
+		armor, err := wrapTwoFactor(wallet.inner, recipients)
+		if err != nil {
+			return err
+		}
+		recoveryArmor, recovery, err := s.recoveryArmor(wallet.Account())
+		if err != nil {
+			return err
+		}
+		enc := &encryptedAccount{armor: string(armor), recoveryArmor: recoveryArmor, recovery: recovery, kdf: wallet.KDF}
+		return s.replaceArmor(wallet, "TWOFACTOR", enc, recordedRecipients(recipients), named, wallet.inner)
 	}
 
-	config, err := nkn.MergeWalletConfig(nil)
+	enc, err := s.encryptAccount(wallet.Account(), recipients)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	typ := "IDENTITY"
+	if isScrypt(recipients) {
+		typ = "SCRYPT"
+	}
+	return s.replaceArmor(wallet, typ, enc, recordedRecipients(recipients), named, nil)
+}
 
-	w.account = account
-	w.config = config
-	return w, nil
+// replaceArmor saves the new encryption of wallet.
+func (s *Store) replaceArmor(wallet *Wallet, typ string, enc *encryptedAccount, recipients, named []string, inner []byte) error {
+	return s.update(func() error {
+		w := s.findWallet(wallet.ID)
+		if w == nil || w.Address() != wallet.Address() {
+			return errors.New("Could not find wallet.")
+		}
+		for _, target := range []*Wallet{w, wallet} {
+			target.Type = typ
+			target.Armor = enc.armor
+			target.RecoveryArmor = enc.recoveryArmor
+			target.Recovery = enc.recovery
+			target.Recipients = recipients
+			target.NamedRecipients = named
+			target.KDF = enc.kdf
+		}
+		wallet.inner = inner
+		return nil
+	})
 }
 
+// NewWalletByIdentity returns the account with index decrypted with the
+// identity file. If index is 0 a new account encrypted to the recipients of
+// the identity file is created.
 func (s *Store) NewWalletByIdentity(identity string, index int, config *nkn.WalletConfig) (*Wallet, error) {
-	if index > 0 {
-		return s.getWalletByIndex(index, identity)
-	}
-
-	recipients, err := s.ParseIdentity(identity)
-	if err != nil {
-		return nil, err
-	}
-
-	account, err := nkn.NewAccount(nil)
-	if err != nil {
-		return nil, err
-	}
-
-	armor, err := encryptAccount(account, recipients)
-	if err != nil {
-		return nil, err
-	}
-
-	config, err = nkn.MergeWalletConfig(config)
-	if err != nil {
-		return nil, err
-	}
-
-	w := &Wallet{
-		ID:         s.getNextID(),
-		Type:       "IDENTITY",
-		NKNAddress: account.WalletAddress(),
-		Armor:      string(armor),
-		Alias:      "",
-		config:     config,
-		lock:       sync.Mutex{},
-		account:    account,
-	}
-	return w, nil
+	return s.NewWallet("identity", AccountKey{Identity: identity}, index, config)
 }
 
+// NewWalletByRecipientFile creates a new account encrypted to the recipients
+// listed in file.
 func (s *Store) NewWalletByRecipientFile(file string, index int, config *nkn.WalletConfig) (*Wallet, error) {
-	if index > 0 {
-		return s.getWalletByIndex(index, file)
-	}
-
-	recipients, err := s.ParseRecipientFile(file)
-	if err != nil {
-		return nil, err
-	}
-
-	account, err := nkn.NewAccount(nil)
-	if err != nil {
-		return nil, err
-	}
-
-	armor, err := encryptAccount(account, recipients)
-	if err != nil {
-		return nil, err
-	}
-
-	config, err = nkn.MergeWalletConfig(config)
-	if err != nil {
-		return nil, err
-	}
-
-	w := &Wallet{
-		ID:         s.getNextID(),
-		Type:       "IDENTITY",
-		NKNAddress: account.WalletAddress(),
-		Armor:      string(armor),
-		Alias:      "",
-		config:     config,
-		lock:       sync.Mutex{},
-		account:    account,
-	}
-	return w, nil
+	return s.NewWallet("recipient-file", AccountKey{RecipientFile: file}, index, config)
 }
 
+// NewWalletByRecipient creates a new account encrypted to recipient.
 func (s *Store) NewWalletByRecipient(recipient string, index int, config *nkn.WalletConfig) (*Wallet, error) {
-	if index > 0 {
-		return s.getWalletByIndex(index, recipient)
-	}
-
-	recipients, err := s.ParseRecipient(recipient)
-	if err != nil {
-		return nil, err
-	}
-
-	account, err := nkn.NewAccount(nil)
-	if err != nil {
-		return nil, err
-	}
-
-	armor, err := encryptAccount(account, recipients)
-	if err != nil {
-		return nil, err
-	}
-
-	config, err = nkn.MergeWalletConfig(config)
-	if err != nil {
-		return nil, err
-	}
-
-	w := &Wallet{
-		ID:         s.getNextID(),
-		Type:       "IDENTITY",
-		NKNAddress: account.WalletAddress(),
-		Armor:      string(armor),
-		Alias:      "",
-		config:     config,
-		lock:       sync.Mutex{},
-		account:    account,
-	}
-	return w, nil
+	return s.NewWallet("recipient", AccountKey{Recipient: recipient}, index, config)
 }
 
+// NewWalletByPassword returns the account with index decrypted with a
+// prompted passphrase. If index is 0 a new account encrypted with a prompted
+// passphrase is created.
 func (s *Store) NewWalletByPassword(index int, config *nkn.WalletConfig) (*Wallet, error) {
-	if index > 0 {
-		w, err := s.GetWalletByIndex(index)
-		if err != nil {
-			return nil, err
-		}
-		if w == nil {
-			return nil, errors.New("could not get wallet")
-		}
-		if strings.ToLower(w.Type) == "identity" {
-			return nil, errors.New("Wallet is not an scrypt type. Use an identity file to decrypt it.")
-		}
-
-		account, err := decryptAccountByPassword(w)
-		if err != nil {
-			return nil, err
-		}
-
-		config, err := nkn.MergeWalletConfig(nil)
-		if err != nil {
-			return nil, err
-		}
-
-		w.account = account
-		w.config = config
-		return w, nil
-	}
-
-	pass, err := passphrasePromptForEncryption()
-	if err != nil {
-		return nil, err
-	}
-
-	r, err := age.NewScryptRecipient(pass)
-	if err != nil {
-		return nil, err
-	}
-
-	account, err := nkn.NewAccount(nil)
-	if err != nil {
-		return nil, err
-	}
-
-	armor, err := encryptAccount(account, []age.Recipient{r})
-	if err != nil {
-		return nil, err
-	}
-
-	config, err = nkn.MergeWalletConfig(config)
-	if err != nil {
-		return nil, err
-	}
-
-	w := &Wallet{
-		ID:         s.getNextID(),
-		Type:       "SCRYPT",
-		NKNAddress: account.WalletAddress(),
-		Armor:      string(armor),
-		Alias:      "",
-		config:     config,
-		lock:       sync.Mutex{},
-		account:    account,
-	}
-	return w, nil
+	return s.NewWallet("scrypt", AccountKey{}, index, config)
 }
 
 func (s *Store) ParseIdentity(identity string) ([]age.Recipient, error) {
 	var recipients []age.Recipient
 
-	ids, err := parseIdentitiesFile(identity)
+	ids, err := parseIdentitiesFile(identity, s.PassphraseProvider())
 	if err != nil {
 		return nil, err
 	}
@@ -522,9 +519,7 @@ func (s *Store) ParseRecipient(recipient string) ([]age.Recipient, error) {
 
 	r, err := parseRecipient(recipient)
 	if err, ok := err.(gitHubRecipientError); ok {
-		// dont do anything with err for now
-		_ = err
-		return nil, errors.New("Github user keys as recipient is not implemented yet.")
+		return s.keyServerRecipients(err.username)
 	}
 	if err != nil {
 		return nil, err
@@ -535,6 +530,8 @@ func (s *Store) ParseRecipient(recipient string) ([]age.Recipient, error) {
 }
 
 func (s *Store) SetName(index int, alias string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for i, w := range s.wallets {
 		if w.ID == index {
 			s.wallets[i].Alias = alias
@@ -543,15 +540,19 @@ func (s *Store) SetName(index int, alias string) {
 }
 
 func (s *Store) SaveWallet(wallet *Wallet) error {
-	for _, w := range s.wallets {
-		if w.Address() == wallet.Address() {
-			return errors.New("Account already exists in store.")
+	return s.update(func() error {
+		for _, w := range s.wallets {
+			if w.Address() == wallet.Address() {
+				return errors.New("Account already exists in store.")
+			}
 		}
-	}
-	s.wallets = append(s.wallets, wallet)
-	s.save()
-
-	return nil
+		// another process may have taken the ID since the wallet was created
+		if wallet.ID == 0 || s.findWallet(wallet.ID) != nil {
+			wallet.ID = s.nextID()
+		}
+		s.wallets = append(s.wallets, wallet)
+		return nil
+	})
 }
 
 func (w *Wallet) OpenAPI() *Openapi {
@@ -563,19 +564,34 @@ func (w *Wallet) Account() *nkn.Account {
 	return w.account
 }
 
+// ErrSeedUnavailable is returned when the seed of an account is needed but
+// the wallet was not decrypted, e.g. it signs through an agent or an external
+// signer.
+var ErrSeedUnavailable = errors.New("Seed of the account is not available. Decrypt the account to use it.")
+
 // Seed returns the secret seed of the wallet. Secret seed can be used to create
-// client/wallet with the same key pair and should be kept secret and safe.
+// client/wallet with the same key pair and should be kept secret and safe. It
+// is nil if the wallet was not decrypted.
 func (w *Wallet) Seed() []byte {
-	return w.Account().Seed()
+	if w.account == nil {
+		return nil
+	}
+	return w.account.Seed()
 }
 
+// ShowSeed returns the seed of the wallet hex encoded, or an empty string if
+// the wallet was not decrypted.
 func (w *Wallet) ShowSeed() string {
-	return hex.EncodeToString(w.Account().Seed())
+	return hex.EncodeToString(w.Seed())
 }
 
 // PubKey returns the public key of the wallet.
 func (w *Wallet) PubKey() []byte {
-	return w.Account().PubKey()
+	if signer := w.Signer(); signer != nil {
+		return signer.PubKey()
+	}
+	pubKey, _ := hex.DecodeString(w.PublicKey)
+	return pubKey
 }
 
 // Address returns the NKN wallet address of the wallet.
@@ -585,7 +601,11 @@ func (w *Wallet) Address() string {
 
 // VerifyPassword returns nil if provided password is the correct password of account
 func (w *Wallet) VerifyPassword(password []byte) error {
-	account, err := decryptAccountByPassword(w)
+	identity := &LazyScryptIdentity{
+		Passphrase:    func() (string, error) { return string(password), nil },
+		MaxWorkFactor: w.ScryptWorkFactor(),
+	}
+	account, err := decryptAccount(w.Armor, []age.Identity{identity})
 	if err != nil {
 		return err
 	}
@@ -602,17 +622,29 @@ func (w *Wallet) VerifyPassword(password []byte) error {
 
 // ProgramHash returns the program hash of this wallet's account.
 func (w *Wallet) ProgramHash() common.Uint160 {
-	return w.Account().ProgramHash
+	if w.account != nil {
+		return w.Account().ProgramHash
+	}
+	programHash, _ := common.ToScriptHash(w.Address())
+	return programHash
 }
 
-// SignTransaction signs an unsigned transaction using this wallet's key pair.
+// SignTransaction signs an unsigned transaction using this wallet's key pair,
+// or the signer it was opened with.
 func (w *Wallet) SignTransaction(tx *transaction.Transaction) error {
-	ct, err := program.CreateSignatureProgramContext(w.Account().PublicKey)
+	if w.IsWatchOnly() {
+		return WatchOnlyError{w.Address()}
+	}
+	signer := w.Signer()
+	if signer == nil {
+		return errors.New("Wallet is not decrypted.")
+	}
+	ct, err := program.CreateSignatureProgramContext(signer.PubKey())
 	if err != nil {
 		return err
 	}
 
-	sig, err := signature.SignBySigner(tx, w.Account().Account)
+	sig, err := signer.Sign(tx)
 	if err != nil {
 		return err
 	}
@@ -625,6 +657,9 @@ func (w *Wallet) SignTransaction(tx *transaction.Transaction) error {
 //
 // Duration is changed to signed int for gomobile compatibility.
 func (w *Wallet) NewNanoPay(recipientAddress, fee string, duration int) (*nkn.NanoPay, error) {
+	if w.account == nil {
+		return nil, ErrSeedUnavailable
+	}
 	nknwallet, err := nkn.NewWallet(w.Account(), w.config)
 	if err != nil {
 		return nil, err
@@ -635,6 +670,9 @@ func (w *Wallet) NewNanoPay(recipientAddress, fee string, duration int) (*nkn.Na
 // NewNanoPayClaimer is a shortcut for NewNanoPayClaimer using this wallet as
 // RPC client.
 func (w *Wallet) NewNanoPayClaimer(recipientAddress string, claimIntervalMs, lingerMs int32, minFlushAmount string, onError *nkn.OnError) (*nkn.NanoPayClaimer, error) {
+	if w.account == nil {
+		return nil, ErrSeedUnavailable
+	}
 	if len(recipientAddress) == 0 {
 		recipientAddress = w.Address()
 	}
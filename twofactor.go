@@ -0,0 +1,163 @@
+package nknwallet
+
+import (
+	"bytes"
+	"errors"
+
+	"filippo.io/age"
+	"github.com/nknorg/nkn-sdk-go"
+)
+
+// TWOFACTOR accounts nest two layers of encryption: the account is encrypted
+// with a passphrase like a SCRYPT account and that armor is encrypted again to
+// the recipients of an identity. Decrypting needs both the identity and the
+// passphrase. Two layers are needed because age does not allow a scrypt
+// recipient next to other recipients.
+
+// encryptAccountTwoFactor encrypts account with pass and the scrypt work
+// factor and the result to recipients. It returns the inner and the outer
+// armor.
+func encryptAccountTwoFactor(account *nkn.Account, recipients []age.Recipient, pass string, workFactor int) ([]byte, []byte, error) {
+	if isScrypt(recipients) {
+		return nil, nil, errors.New("The outer layer of a two-factor account can't be a passphrase.")
+	}
+	r, err := newScryptRecipient(pass, workFactor)
+	if err != nil {
+		return nil, nil, err
+	}
+	inner, err := encryptAccount(account, []age.Recipient{r})
+	if err != nil {
+		return nil, nil, err
+	}
+	outer, err := wrapTwoFactor(inner, recipients)
+	if err != nil {
+		return nil, nil, err
+	}
+	return inner, outer, nil
+}
+
+// wrapTwoFactor encrypts the inner armor of a two-factor account to
+// recipients.
+func wrapTwoFactor(inner []byte, recipients []age.Recipient) ([]byte, error) {
+	out := &bytes.Buffer{}
+	if err := encrypt(recipients, bytes.NewReader(inner), out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// unwrapTwoFactor decrypts the outer layer of a two-factor account with
+// identities and returns the inner, passphrase encrypted armor.
+func unwrapTwoFactor(walletfile *Wallet, ids []age.Identity) ([]byte, error) {
+	out := &bytes.Buffer{}
+	identities := append([]age.Identity{rejectScryptIdentity{}}, ids...)
+	if err := decrypt(identities, bytes.NewBufferString(walletfile.Armor), out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// decryptAccountTwoFactor decrypts a two-factor account with the identity file
+// and a passphrase from pp. It also returns the inner armor.
+func decryptAccountTwoFactor(walletfile *Wallet, identity string, pp PassphraseProvider) (*nkn.Account, []byte, error) {
+	ids, err := parseIdentitiesFile(identity, pp)
+	if err != nil {
+		return nil, nil, err
+	}
+	inner, err := unwrapTwoFactor(walletfile, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	account, err := decryptAccountByPassword(&Wallet{Armor: string(inner)}, pp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, inner, nil
+}
+
+// NewWalletByIdentityAndPassword returns the two-factor account with the
+// given index, decrypted with the identity file and a prompted passphrase. If
+// index is 0 a new account encrypted with a prompted passphrase and to the
+// recipients of the identity file is created.
+func (s *Store) NewWalletByIdentityAndPassword(identity string, index int, config *nkn.WalletConfig) (*Wallet, error) {
+	return s.NewWallet("twofactor", AccountKey{Identity: identity}, index, config)
+}
+
+// RestoreFromSeedByIdentityAndPassword encrypts seed as two-factor account
+// with a prompted passphrase and to the recipients of the identity file.
+func (s *Store) RestoreFromSeedByIdentityAndPassword(seed []byte, identity string) (*Wallet, error) {
+	return s.RestoreFromSeed("twofactor", seed, AccountKey{Identity: identity})
+}
+
+// RestoreFromSeedByRecipientsAndPassphrase encrypts seed as two-factor
+// account with pass and to recipients.
+func (s *Store) RestoreFromSeedByRecipientsAndPassphrase(seed []byte, recipients []age.Recipient, pass string) (*Wallet, error) {
+	return s.restoreFromSeed(seed, func(account *nkn.Account) (*Wallet, error) {
+		return s.encryptTwoFactor(account, recipients, pass)
+	})
+}
+
+// encryptTwoFactor returns a new TWOFACTOR account encrypting account with
+// pass and to recipients.
+func (s *Store) encryptTwoFactor(account *nkn.Account, recipients []age.Recipient, pass string) (*Wallet, error) {
+	inner, armor, err := encryptAccountTwoFactor(account, recipients, pass, s.ScryptWorkFactor())
+	if err != nil {
+		return nil, err
+	}
+	recoveryArmor, recovery, err := s.recoveryArmor(account)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{
+		Type:          "TWOFACTOR",
+		Armor:         string(armor),
+		RecoveryArmor: recoveryArmor,
+		Recovery:      recovery,
+		Recipients:    recordedRecipients(recipients),
+		KDF:           armorKDF(string(inner)),
+		inner:         inner,
+	}, nil
+}
+
+// SetTwoFactorPassword changes the passphrase of a decrypted two-factor
+// account, keeping the recipients it is encrypted to.
+func (s *Store) SetTwoFactorPassword(wallet *Wallet) error {
+	return s.setTwoFactorPassphrase(wallet, AccountKey{})
+}
+
+// setTwoFactorPassphrase changes the passphrase of a decrypted two-factor
+// account to the one of key, or a prompted one.
+func (s *Store) setTwoFactorPassphrase(wallet *Wallet, key AccountKey) error {
+	if wallet.Type != "TWOFACTOR" {
+		return errors.New("Wallet is not a two-factor account.")
+	}
+	if wallet.Account() == nil {
+		return errors.New("Wallet is not decrypted.")
+	}
+	if len(wallet.Recipients) == 0 {
+		return errors.New("Recipients of the account are unknown. Use change recipients to set them.")
+	}
+	var recipients []age.Recipient
+	for _, name := range wallet.Recipients {
+		r, err := parseRecipient(name)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, r)
+	}
+
+	pass, err := s.changedKeyPassphrase(key)
+	if err != nil {
+		return err
+	}
+	inner, armor, err := encryptAccountTwoFactor(wallet.Account(), recipients, pass, s.ScryptWorkFactor())
+	if err != nil {
+		return err
+	}
+	recoveryArmor, recovery, err := s.recoveryArmor(wallet.Account())
+	if err != nil {
+		return err
+	}
+	enc := &encryptedAccount{armor: string(armor), recoveryArmor: recoveryArmor, recovery: recovery, kdf: armorKDF(string(inner))}
+	return s.replaceArmor(wallet, "TWOFACTOR", enc, wallet.Recipients, wallet.NamedRecipients, inner)
+}
@@ -0,0 +1,97 @@
+package nknwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nknorg/nkn/v2/common"
+	"github.com/nknorg/nkn/v2/program"
+	"github.com/nknorg/nkn/v2/transaction"
+)
+
+// TxInfo describes every field of a transaction, see InspectTx.
+type TxInfo struct {
+	Hash        string `json:"hash"`
+	PayloadType string `json:"payload_type"`
+	*TxSummary
+	Size     uint32      `json:"size"`
+	Programs []TxProgram `json:"programs"`
+	// Signed reports whether the transaction carries programs.
+	Signed bool `json:"signed"`
+	// SignatureValid reports whether the programs match the program hashes
+	// of the senders and their signatures verify. SignatureError says why
+	// not.
+	SignatureValid bool   `json:"signature_valid"`
+	SignatureError string `json:"signature_error,omitempty"`
+}
+
+// TxProgram is a program of a transaction: the code holding the public key of
+// a signer and the parameter holding its signature.
+type TxProgram struct {
+	Address   string `json:"address,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Code      string `json:"code"`
+	Parameter string `json:"parameter"`
+}
+
+// DecodeTx decodes a protobuf encoded transaction, given raw or hex encoded.
+func DecodeTx(dat []byte) (*transaction.Transaction, error) {
+	if s := strings.TrimPrefix(string(bytes.TrimSpace(dat)), "0x"); len(s) > 0 {
+		if b, err := hex.DecodeString(s); err == nil {
+			dat = b
+		}
+	}
+	if len(dat) == 0 {
+		return nil, errors.New("Transaction is empty.")
+	}
+	tx := &transaction.Transaction{}
+	if err := tx.Unmarshal(dat); err != nil {
+		return nil, fmt.Errorf("Invalid transaction: %v", err)
+	}
+	if tx.UnsignedTx == nil || tx.UnsignedTx.Payload == nil {
+		return nil, errors.New("Invalid transaction: it has no payload.")
+	}
+	return tx, nil
+}
+
+// InspectTx returns the fields of tx and whether its signatures verify.
+func InspectTx(tx *transaction.Transaction) (*TxInfo, error) {
+	summary, err := SummarizeTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	hash := tx.Hash()
+	info := &TxInfo{
+		Hash:        hash.ToHexString(),
+		PayloadType: tx.UnsignedTx.Payload.Type.String(),
+		TxSummary:   summary,
+		Size:        tx.GetSize(),
+		Programs:    []TxProgram{},
+		Signed:      len(tx.Programs) > 0,
+	}
+	for _, p := range tx.Programs {
+		tp := TxProgram{Code: hex.EncodeToString(p.Code), Parameter: hex.EncodeToString(p.Parameter)}
+		if programHash, err := common.ToCodeHash(p.Code); err == nil {
+			tp.Address, _ = programHash.ToAddress()
+		}
+		if pubKey, err := program.GetPublicKeyFromCode(p.Code); err == nil {
+			tp.PublicKey = hex.EncodeToString(pubKey)
+		}
+		if sig, err := program.GetSignatureFromParameter(p.Parameter); err == nil {
+			tp.Signature = hex.EncodeToString(sig)
+		}
+		info.Programs = append(info.Programs, tp)
+	}
+	if info.Signed {
+		if err := tx.VerifySignature(); err != nil {
+			info.SignatureError = err.Error()
+		} else {
+			info.SignatureValid = true
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,86 @@
+package nknwallet
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeTx(t *testing.T) {
+	sender := testAccount(t)
+	other := testAccount(t)
+	unsigned, err := testOfflineTx(t, sender, 3).UnsignedTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := unsigned.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBy := func(w *Wallet) []byte {
+		tx, err := DecodeTx(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dat, err := hex.DecodeString(signedTxHex(t, w, tx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dat
+	}
+	signed := signedBy(sender)
+	wrongKey := signedBy(other)
+	hash := unsigned.Hash()
+
+	tests := []struct {
+		name    string
+		input   []byte
+		signed  bool
+		valid   bool
+		invalid bool
+	}{
+		{name: "raw protobuf", input: raw},
+		{name: "hex", input: []byte(hex.EncodeToString(raw))},
+		{name: "0x prefixed hex", input: []byte("0x" + hex.EncodeToString(raw))},
+		{name: "hex with whitespace", input: []byte("  " + hex.EncodeToString(raw) + "\n")},
+		{name: "signed by the sender", input: []byte(hex.EncodeToString(signed)), signed: true, valid: true},
+		{name: "signed by another key", input: wrongKey, signed: true, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := DecodeTx(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := InspectTx(tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Hash != hash.ToHexString() {
+				t.Fatalf("hash = %s, want %s", info.Hash, hash.ToHexString())
+			}
+			if info.Kind != TxTransfer || info.Sender != sender.Address() || info.Nonce != 3 {
+				t.Fatalf("decoded %s from %s with nonce %d", info.Kind, info.Sender, info.Nonce)
+			}
+			if info.Signed != tt.signed || info.SignatureValid != tt.valid || (len(info.SignatureError) > 0) != tt.invalid {
+				t.Fatalf("signed %v, signature valid %v, signature error %q", info.Signed, info.SignatureValid, info.SignatureError)
+			}
+			if tt.signed && (len(info.Programs) != 1 || len(info.Programs[0].Signature) == 0) {
+				t.Fatalf("programs = %+v, want one with a signature", info.Programs)
+			}
+			if tt.valid && info.Programs[0].Address != sender.Address() {
+				t.Fatalf("program is for %s, want %s", info.Programs[0].Address, sender.Address())
+			}
+			if tt.invalid && info.Programs[0].Address != other.Address() {
+				t.Fatalf("program is for %s, want %s", info.Programs[0].Address, other.Address())
+			}
+		})
+	}
+}
+
+func TestDecodeTxInvalid(t *testing.T) {
+	for _, input := range []string{"", "  \n", "0x", "not a transaction", "0xzz"} {
+		if _, err := DecodeTx([]byte(input)); err == nil {
+			t.Errorf("DecodeTx(%q) succeeded", input)
+		}
+	}
+}
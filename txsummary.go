@@ -0,0 +1,190 @@
+package nknwallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/nknorg/nkn/v2/common"
+	"github.com/nknorg/nkn/v2/pb"
+	"github.com/nknorg/nkn/v2/transaction"
+)
+
+// Transaction kinds that can be built for offline signing, see BuildTx.
+const (
+	TxTransfer     = "transfer"
+	TxRegisterName = "register-name"
+	TxTransferName = "transfer-name"
+	TxDeleteName   = "delete-name"
+	TxSubscribe    = "subscribe"
+	TxUnsubscribe  = "unsubscribe"
+)
+
+// TxSummary describes a transaction for humans. It is derived from the
+// transaction itself, so it shows what is actually signed.
+type TxSummary struct {
+	Kind      string `json:"kind"`
+	Sender    string `json:"sender,omitempty"`
+	Recipient string `json:"recipient,omitempty"`
+	Amount    string `json:"amount,omitempty"`
+	Fee       string `json:"fee"`
+	Nonce     uint64 `json:"nonce"`
+	// Name is the registered name of name transactions.
+	Name            string `json:"name,omitempty"`
+	RegistrationFee string `json:"registration_fee,omitempty"`
+	// Topic, Identifier, Duration and Meta describe (un)subscriptions.
+	Topic      string `json:"topic,omitempty"`
+	Identifier string `json:"identifier,omitempty"`
+	Duration   uint32 `json:"duration,omitempty"`
+	Meta       string `json:"meta,omitempty"`
+	// ID, TxnExpiration and NanoPayExpiration describe nano payments.
+	ID                uint64 `json:"id,omitempty"`
+	TxnExpiration     uint32 `json:"txn_expiration,omitempty"`
+	NanoPayExpiration uint32 `json:"nano_pay_expiration,omitempty"`
+	// PublicKey and Version describe ID generation.
+	PublicKey string `json:"public_key,omitempty"`
+	Version   int32  `json:"version,omitempty"`
+	// Symbol, TotalSupply and Precision describe issued assets.
+	Symbol      string `json:"symbol,omitempty"`
+	TotalSupply string `json:"total_supply,omitempty"`
+	Precision   uint32 `json:"precision,omitempty"`
+	// Attributes are the hex encoded attributes of the transaction.
+	Attributes string `json:"attributes,omitempty"`
+}
+
+// SummarizeTx returns the summary of tx.
+func SummarizeTx(tx *transaction.Transaction) (*TxSummary, error) {
+	if tx.UnsignedTx == nil || tx.UnsignedTx.Payload == nil {
+		return nil, errors.New("Transaction has no payload.")
+	}
+	s := &TxSummary{
+		Kind:       tx.UnsignedTx.Payload.Type.String(),
+		Fee:        common.Fixed64(tx.UnsignedTx.Fee).String(),
+		Nonce:      tx.UnsignedTx.Nonce,
+		Attributes: hex.EncodeToString(tx.UnsignedTx.Attributes),
+	}
+	payload, err := transaction.Unpack(tx.UnsignedTx.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid payload: %v", err)
+	}
+
+	switch p := payload.(type) {
+	case *pb.TransferAsset:
+		s.Kind = TxTransfer
+		s.Sender, err = programHashToAddress(p.Sender)
+		if err == nil {
+			s.Recipient, err = programHashToAddress(p.Recipient)
+		}
+		s.Amount = common.Fixed64(p.Amount).String()
+	case *pb.RegisterName:
+		s.Kind = TxRegisterName
+		s.Sender, err = pubKeyToAddress(p.Registrant)
+		s.Name = p.Name
+		s.RegistrationFee = common.Fixed64(p.RegistrationFee).String()
+	case *pb.TransferName:
+		s.Kind = TxTransferName
+		s.Sender, err = pubKeyToAddress(p.Registrant)
+		if err == nil {
+			s.Recipient, err = pubKeyToAddress(p.Recipient)
+		}
+		s.Name = p.Name
+	case *pb.DeleteName:
+		s.Kind = TxDeleteName
+		s.Sender, err = pubKeyToAddress(p.Registrant)
+		s.Name = p.Name
+	case *pb.Subscribe:
+		s.Kind = TxSubscribe
+		s.Sender, err = pubKeyToAddress(p.Subscriber)
+		s.Topic, s.Identifier, s.Duration, s.Meta = p.Topic, p.Identifier, p.Duration, string(p.Meta)
+	case *pb.Unsubscribe:
+		s.Kind = TxUnsubscribe
+		s.Sender, err = pubKeyToAddress(p.Subscriber)
+		s.Topic, s.Identifier = p.Topic, p.Identifier
+	case *pb.Coinbase:
+		s.Kind = "coinbase"
+		s.Sender, err = programHashToAddress(p.Sender)
+		if err == nil {
+			s.Recipient, err = programHashToAddress(p.Recipient)
+		}
+		s.Amount = common.Fixed64(p.Amount).String()
+	case *pb.NanoPay:
+		s.Kind = "nano-pay"
+		s.Sender, err = programHashToAddress(p.Sender)
+		if err == nil {
+			s.Recipient, err = programHashToAddress(p.Recipient)
+		}
+		s.Amount = common.Fixed64(p.Amount).String()
+		s.ID, s.TxnExpiration, s.NanoPayExpiration = p.Id, p.TxnExpiration, p.NanoPayExpiration
+	case *pb.SigChainTxn:
+		s.Kind = "sig-chain"
+		s.Sender, err = programHashToAddress(p.Submitter)
+	case *pb.GenerateID:
+		s.Kind = "generate-id"
+		s.Sender, err = programHashToAddress(p.Sender)
+		s.PublicKey = hex.EncodeToString(p.PublicKey)
+		s.RegistrationFee = common.Fixed64(p.RegistrationFee).String()
+		s.Version = p.Version
+	case *pb.IssueAsset:
+		s.Kind = "issue-asset"
+		s.Sender, err = programHashToAddress(p.Sender)
+		s.Name, s.Symbol, s.Precision = p.Name, p.Symbol, p.Precision
+		s.TotalSupply = common.Fixed64(p.TotalSupply).String()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid payload: %v", err)
+	}
+	return s, nil
+}
+
+// Fields returns the set fields of the summary as label and value pairs, in
+// the order they are best read.
+func (s *TxSummary) Fields() [][2]string {
+	fields := [][2]string{{"kind", s.Kind}}
+	add := func(label, value string) {
+		if len(value) > 0 {
+			fields = append(fields, [2]string{label, value})
+		}
+	}
+	add("sender", s.Sender)
+	add("recipient", s.Recipient)
+	add("amount", s.Amount)
+	add("name", s.Name)
+	add("registration fee", s.RegistrationFee)
+	add("topic", s.Topic)
+	add("identifier", s.Identifier)
+	if s.Duration > 0 {
+		add("duration", strconv.FormatUint(uint64(s.Duration), 10)+" blocks")
+	}
+	add("meta", s.Meta)
+	if s.ID > 0 {
+		add("id", strconv.FormatUint(s.ID, 10))
+	}
+	if s.TxnExpiration > 0 {
+		add("txn expiration", "height "+strconv.FormatUint(uint64(s.TxnExpiration), 10))
+	}
+	if s.NanoPayExpiration > 0 {
+		add("nano pay expiration", "height "+strconv.FormatUint(uint64(s.NanoPayExpiration), 10))
+	}
+	add("public key", s.PublicKey)
+	if s.Version != 0 {
+		add("version", strconv.FormatInt(int64(s.Version), 10))
+	}
+	add("symbol", s.Symbol)
+	add("total supply", s.TotalSupply)
+	if len(s.Symbol) > 0 {
+		add("precision", strconv.FormatUint(uint64(s.Precision), 10))
+	}
+	add("fee", s.Fee)
+	add("nonce", strconv.FormatUint(s.Nonce, 10))
+	add("attributes", s.Attributes)
+	return fields
+}
+
+func programHashToAddress(b []byte) (string, error) {
+	programHash, err := common.Uint160ParseFromBytes(b)
+	if err != nil {
+		return "", err
+	}
+	return programHash.ToAddress()
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"log"
 	"strings"
@@ -14,7 +13,6 @@ import (
 	"filippo.io/age/armor"
 	"github.com/nknorg/nkn-sdk-go"
 	"github.com/nknorg/nkn/v2/crypto"
-	"github.com/nknorg/nkn/v2/util/password"
 	"github.com/nknorg/nkn/v2/vault"
 )
 
@@ -36,7 +34,7 @@ func (rejectScryptIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
 	if len(stanzas) != 1 || stanzas[0].Type != "scrypt" {
 		return nil, age.ErrIncorrectIdentity
 	}
-	return nil, fmt.Errorf("file is passphrase-encrypted but identities were specified with -i/--identity or -j",
+	return nil, errors.New("file is passphrase-encrypted but identities were specified with -i/--identity or -j: " +
 		"remove all -i/--identity/-j flags to decrypt passphrase-encrypted files")
 }
 
@@ -105,13 +103,17 @@ func decrypt(identities []age.Identity, in io.Reader, out io.Writer) error {
 	return nil
 }
 
-func decryptAccountByPassword(walletfile *Wallet) (*nkn.Account, error) {
-	in := bytes.NewBuffer([]byte(walletfile.Armor))
-	out := &bytes.Buffer{}
-
+func decryptAccountByPassword(walletfile *Wallet, pp PassphraseProvider) (*nkn.Account, error) {
 	identities := []age.Identity{
-		&LazyScryptIdentity{passphrasePromptForDecryption},
+		&LazyScryptIdentity{Passphrase: passphraseFunc(pp, "Enter passphrase"), MaxWorkFactor: walletfile.ScryptWorkFactor()},
 	}
+	return decryptAccount(walletfile.Armor, identities)
+}
+
+// decryptAccount decrypts an account armor with identities.
+func decryptAccount(armor string, identities []age.Identity) (*nkn.Account, error) {
+	in := bytes.NewBufferString(armor)
+	out := &bytes.Buffer{}
 
 	err := decrypt(identities, in, out)
 	if err != nil {
@@ -128,66 +130,29 @@ func decryptAccountByPassword(walletfile *Wallet) (*nkn.Account, error) {
 	return nkn.NewAccount(seed)
 }
 
-func decryptAccountByIdentityFile(walletfile *Wallet, identity string) (*nkn.Account, error) {
-	in := bytes.NewBuffer([]byte(walletfile.Armor))
-	out := &bytes.Buffer{}
-
-	identities := []age.Identity{rejectScryptIdentity{}}
-	ids, err := parseIdentitiesFile(identity)
+func decryptAccountByIdentityFile(walletfile *Wallet, identity string, pp PassphraseProvider) (*nkn.Account, error) {
+	ids, err := parseIdentitiesFile(identity, pp)
 	if err != nil {
 		return nil, err
 	}
-	identities = append(identities, ids...)
-
-	err = decrypt(identities, in, out)
-	if err != nil {
-		return nil, err
-	}
-
-	account := &vault.Account{}
-	err = json.NewDecoder(out).Decode(account)
-	if err != nil {
-		return nil, err
-	}
-	seed := crypto.GetSeedFromPrivateKey(account.PrivateKey)
-
-	return nkn.NewAccount(seed)
+	return decryptAccountByIdentities(walletfile, ids)
 }
 
-func passphrasePromptForDecryption() (string, error) {
-	pass, err := password.GetPassword("Enter passphrase")
-	if err != nil {
-		return "", fmt.Errorf("could not read passphrase: %v", err)
-	}
-	return string(pass), nil
+// decryptAccountByIdentities decrypts the account of walletfile with
+// identities. Passphrase encrypted accounts are rejected.
+func decryptAccountByIdentities(walletfile *Wallet, ids []age.Identity) (*nkn.Account, error) {
+	identities := append([]age.Identity{rejectScryptIdentity{}}, ids...)
+	return decryptAccount(walletfile.Armor, identities)
 }
 
-func passphrasePromptForEncryption() (string, error) {
-	pass, err := password.GetPassword("Enter passphrase (leave empty to autogenerate a secure one)")
-	if err != nil {
-		return "", fmt.Errorf("Could not read passphrase: %v", err)
-	}
-	p := string(pass)
-	if p == "" {
-		var words []string
-		for i := 0; i < 10; i++ {
-			words = append(words, randomWord())
-		}
-		p = strings.Join(words, "-")
-		_, err := fmt.Printf("Using autogenerated passphrase %q\n", p)
-		if err != nil {
-			return "", fmt.Errorf("Could not print passphrase: %v", err)
-		}
-	} else {
-		confirm, err := password.GetPassword("Confirm passphrase")
-		if err != nil {
-			return "", fmt.Errorf("Could not read passphrase: %v", err)
-		}
-		if string(confirm) != p {
-			return "", fmt.Errorf("Passphrases didn't match")
-		}
-	}
-	return p, nil
+// GeneratePassphrase returns a random passphrase of ten words from the BIP39
+// english wordlist.
+func GeneratePassphrase() string {
+	var words []string
+	for i := 0; i < 10; i++ {
+		words = append(words, randomWord())
+	}
+	return strings.Join(words, "-")
 }
 
 func encryptAccount(account *nkn.Account, recipients []age.Recipient) ([]byte, error) {
@@ -0,0 +1,89 @@
+package nknwallet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/nknorg/nkn-sdk-go"
+	"github.com/nknorg/nkn/v2/common"
+	"github.com/nknorg/nkn/v2/program"
+)
+
+// WATCH accounts are tracked by their address alone, e.g. cold storage or
+// customer addresses, to query their balance and transactions. The store
+// holds no key for them, so they can't be decrypted or sign.
+
+// WatchOnlyError is returned when a WATCH account is asked to sign or to be
+// decrypted.
+type WatchOnlyError struct {
+	Address string
+}
+
+func (e WatchOnlyError) Error() string {
+	return fmt.Sprintf("Account %s is watch-only. The wallet holds no key for it.", e.Address)
+}
+
+// IsWatchOnly reports whether the account is a WATCH account.
+func (w *Wallet) IsWatchOnly() bool {
+	return strings.ToLower(w.Type) == "watch"
+}
+
+// AddWatch adds a WATCH account for address to the store. pubKey is optional;
+// if given it must belong to the address.
+func (s *Store) AddWatch(address string, pubKey []byte, alias string) (*Wallet, error) {
+	if _, err := common.ToScriptHash(address); err != nil {
+		return nil, fmt.Errorf("Invalid NKN address %s.", address)
+	}
+	if len(pubKey) > 0 {
+		programHash, err := program.CreateProgramHash(pubKey)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid public key: %v", err)
+		}
+		if a, err := programHash.ToAddress(); err != nil || a != address {
+			return nil, fmt.Errorf("Public key does not belong to %s.", address)
+		}
+	}
+
+	w := &Wallet{
+		ID:         s.getNextID(),
+		Type:       "WATCH",
+		NKNAddress: address,
+		Alias:      alias,
+		PublicKey:  hex.EncodeToString(pubKey),
+	}
+	if err := s.SaveWallet(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewWatchWallet returns the WATCH account with index, ready to query the
+// blockchain.
+func (s *Store) NewWatchWallet(index int, config *nkn.WalletConfig) (*Wallet, error) {
+	w, err := s.GetWalletByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	if !w.IsWatchOnly() {
+		return nil, fmt.Errorf("Account %d is not watch-only.", index)
+	}
+	if w.config, err = nkn.MergeWalletConfig(config); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewQueryWallet returns the account with index without decrypting it, ready
+// to query the blockchain, e.g. for the nonce of a cold account. It can't
+// sign.
+func (s *Store) NewQueryWallet(index int, config *nkn.WalletConfig) (*Wallet, error) {
+	w, err := s.GetWalletByIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	if w.config, err = nkn.MergeWalletConfig(config); err != nil {
+		return nil, err
+	}
+	return w, nil
+}